@@ -14,10 +14,14 @@ import { Label } from "@/components/ui/label";
 import api from "@/lib/api";
 import { useRouter } from "next/navigation";
 import { useToast } from "@/hooks/use-toast";
+import { useState } from "react";
 
 export function Login() {
   const router = useRouter();
   const { toast } = useToast();
+  // challenge is set once the password is accepted for an account with
+  // two-factor authentication; the session starts after the code is entered
+  const [challenge, setChallenge] = useState<string | null>(null);
 
   const handleSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
     event.preventDefault();
@@ -35,7 +39,9 @@ export function Login() {
         withCredentials: true,
       });
 
-      if (response.status === 200) {
+      if (response.status === 200 && response.data.mfa_required) {
+        setChallenge(response.data.challenge);
+      } else if (response.status === 200) {
         router.push("/dashboard");
       } else {
         toast({
@@ -53,6 +59,57 @@ export function Login() {
       });
     }
   };
+
+  const handleCodeSubmit = async (event: React.FormEvent<HTMLFormElement>) => {
+    event.preventDefault();
+    const form = new FormData(event.currentTarget);
+    const code = form.get("code") as string;
+
+    try {
+      await api.post("/login/mfa", { challenge, code }, {
+        withCredentials: true,
+      });
+
+      router.push("/dashboard");
+      // eslint-disable-next-line @typescript-eslint/no-unused-vars
+    } catch (error) {
+      toast({
+        title: "Error",
+        description: "Invalid code",
+        variant: "destructive",
+      });
+    }
+  };
+
+  if (challenge) {
+    return (
+      <Card className="mx-auto max-w-sm">
+        <CardHeader>
+          <CardTitle className="text-2xl">Two-factor authentication</CardTitle>
+          <CardDescription>
+            Enter the code from your authenticator app or a recovery code
+          </CardDescription>
+        </CardHeader>
+        <CardContent>
+          <form className="grid gap-4" onSubmit={handleCodeSubmit}>
+            <div className="grid gap-2">
+              <Label htmlFor="code">Code</Label>
+              <Input
+                id="code"
+                name="code"
+                autoComplete="one-time-code"
+                required
+              />
+            </div>
+            <Button type="submit" className="w-full">
+              Verify
+            </Button>
+          </form>
+        </CardContent>
+      </Card>
+    );
+  }
+
   return (
     <Card className="mx-auto max-w-sm">
       <CardHeader>
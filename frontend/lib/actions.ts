@@ -1,8 +1,29 @@
 "use server";
 
 import { cookies } from "next/headers";
+import api from "./api";
 
 export async function logout() {
+  const token = cookies().get("token");
+  const refreshToken = cookies().get("refresh_token");
+
+  // Revoke the session so its tokens stop working, not just the cookies
+  try {
+    await api.post("/logout", null, {
+      headers: {
+        Cookie: [
+          token && `token=${token.value}`,
+          refreshToken && `refresh_token=${refreshToken.value}`,
+        ]
+          .filter(Boolean)
+          .join("; "),
+      },
+    });
+  } catch (e) {
+    console.error(e);
+  }
+
   cookies().delete("token");
+  cookies().delete("refresh_token");
   return;
 }
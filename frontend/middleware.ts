@@ -1,7 +1,36 @@
 import { NextResponse } from "next/server";
 import type { NextRequest } from "next/server";
 
-export function middleware(request: NextRequest) {
+// refresh exchanges the refresh token cookie for new session cookies once
+// the short-lived access token cookie has expired.
+async function refresh(request: NextRequest) {
+  const refreshToken = request.cookies.get("refresh_token");
+
+  if (!refreshToken) {
+    return null;
+  }
+
+  try {
+    const response = await fetch(
+      `${process.env.NEXT_PUBLIC_API_URL || process.env.API_URL}/refresh`,
+      {
+        method: "POST",
+        headers: { Cookie: `refresh_token=${refreshToken.value}` },
+      }
+    );
+
+    if (!response.ok) {
+      return null;
+    }
+
+    return response.headers.getSetCookie();
+  } catch (e) {
+    console.error(e);
+    return null;
+  }
+}
+
+export async function middleware(request: NextRequest) {
   const token = request.cookies.get("token");
 
   if (
@@ -13,7 +42,26 @@ export function middleware(request: NextRequest) {
     }
   } else {
     if (!token) {
-      return NextResponse.redirect(new URL("/login", request.url));
+      const setCookies = await refresh(request);
+
+      if (!setCookies) {
+        return NextResponse.redirect(new URL("/login", request.url));
+      }
+
+      // Let this request's server components see the new access token too
+      for (const cookie of setCookies) {
+        const [pair] = cookie.split(";");
+        const index = pair.indexOf("=");
+        request.cookies.set(pair.slice(0, index), pair.slice(index + 1));
+      }
+
+      const response = NextResponse.next({
+        request: { headers: request.headers },
+      });
+      for (const cookie of setCookies) {
+        response.headers.append("Set-Cookie", cookie);
+      }
+      return response;
     }
   }
 
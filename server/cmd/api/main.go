@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"server/internal/scheduler"
 	"server/internal/server"
 	"strconv"
 	"syscall"
@@ -14,7 +15,7 @@ import (
 	_ "github.com/joho/godotenv/autoload"
 )
 
-func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
+func gracefulShutdown(fiberServer *server.FiberServer, sched *scheduler.Scheduler, done chan bool) {
 	// Create context that listens for the interrupt signal from the OS.
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -32,18 +33,54 @@ func gracefulShutdown(fiberServer *server.FiberServer, done chan bool) {
 		log.Printf("Server forced to shutdown with error: %v", err)
 	}
 
+	// Let the scheduler finish any delivery it has already started
+	if sched != nil {
+		if err := sched.Stop(ctx); err != nil {
+			log.Printf("Scheduler forced to stop with error: %v", err)
+		}
+	}
+
+	// Let the queue workers finish the deliveries they are sending
+	if err := fiberServer.Queue().Stop(ctx); err != nil {
+		log.Printf("Queue forced to stop with error: %v", err)
+	}
+
 	log.Println("Server exiting")
 
 	// Notify the main goroutine that the shutdown is complete
 	done <- true
 }
 
+// schedulerInterval reads SCHEDULER_INTERVAL, defaulting to one minute.
+// A zero interval disables the embedded scheduler.
+func schedulerInterval() time.Duration {
+	value := os.Getenv("SCHEDULER_INTERVAL")
+	if value == "" {
+		return time.Minute
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		log.Fatalf("invalid SCHEDULER_INTERVAL %q", value)
+	}
+
+	return interval
+}
+
 func main() {
 
 	server := server.New()
 
 	server.RegisterFiberRoutes()
 
+	var sched *scheduler.Scheduler
+	if interval := schedulerInterval(); interval > 0 {
+		sched = scheduler.New(server.Dispatcher(), interval)
+		sched.Start()
+	}
+
+	server.Queue().Start()
+
 	// Create a done channel to signal when the shutdown is complete
 	done := make(chan bool, 1)
 
@@ -56,7 +93,7 @@ func main() {
 	}()
 
 	// Run graceful shutdown in a separate goroutine
-	go gracefulShutdown(server, done)
+	go gracefulShutdown(server, sched, done)
 
 	// Wait for the graceful shutdown to complete
 	<-done
@@ -0,0 +1,101 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		expr     string
+		after    string
+		expected string
+	}{
+		{"0 9 * * 1-5", "2024-01-05 09:00:00", "2024-01-08 09:00:00"},
+		{"*/15 * * * *", "2024-01-01 10:07:30", "2024-01-01 10:15:00"},
+		{"0 0 1 * *", "2024-01-15 12:00:00", "2024-02-01 00:00:00"},
+		{"30 8 * jan,jul mon", "2024-01-30 09:00:00", "2024-07-01 08:30:00"},
+		{"0 12 * * SUN", "2024-01-01 00:00:00", "2024-01-07 12:00:00"},
+		{"0 12 * * 7", "2024-01-01 00:00:00", "2024-01-07 12:00:00"},
+		{"0 0 13 * 5", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"15 30 9 * * *", "2024-01-01 09:30:15", "2024-01-02 09:30:15"},
+		{"@daily", "2024-01-01 00:00:00", "2024-01-02 00:00:00"},
+		{"@hourly", "2024-12-31 23:30:00", "2025-01-01 00:00:00"},
+		{"@weekly", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"@yearly", "2024-06-01 00:00:00", "2025-01-01 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error: %v", tt.expr, err)
+			continue
+		}
+
+		after, _ := time.Parse(time.DateTime, tt.after)
+		next := s.Next(after)
+
+		if next.Format(time.DateTime) != tt.expected {
+			t.Errorf("%q after %s: expected %s; got %s", tt.expr, tt.after, tt.expected, next.Format(time.DateTime))
+		}
+	}
+}
+
+func TestNextImpossible(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected no match; got %s", next)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@reboot",
+	}
+
+	for _, expr := range invalid {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("expected Parse(%q) to fail", expr)
+		}
+	}
+}
+
+func TestNextAcrossDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("cannot load time zone: %v", err)
+	}
+
+	skipped, _ := Parse("30 2 * * *")
+	next := skipped.Next(time.Date(2024, 3, 10, 0, 0, 0, 0, loc))
+	if next.Format(time.RFC3339) != "2024-03-10T03:30:00-04:00" {
+		t.Errorf("expected the skipped time to move forward; got %s", next.Format(time.RFC3339))
+	}
+
+	repeated, _ := Parse("30 1 * * *")
+	first := repeated.Next(time.Date(2024, 11, 3, 0, 0, 0, 0, loc))
+	if first.Format(time.RFC3339) != "2024-11-03T01:30:00-04:00" {
+		t.Errorf("expected the first of the repeated times; got %s", first.Format(time.RFC3339))
+	}
+
+	second := repeated.Next(first)
+	if second.Format(time.RFC3339) != "2024-11-04T01:30:00-05:00" {
+		t.Errorf("expected the repeated time to fire once; got %s", second.Format(time.RFC3339))
+	}
+}
@@ -3,11 +3,14 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"server/internal/models"
+	"server/internal/recurrence"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -24,14 +27,31 @@ type Service interface {
 	// It returns an error if the connection cannot be closed.
 	Close() error
 
-	// SaveUser saves a user to the database.
-	SaveUser(email, pass, fname, lname string) error
+	// SaveUser saves a user to the database, with an email channel for
+	// their address.
+	SaveUser(email, pass, fname, lname, timeZone string) error
+
+	// UpdateUserTimeZone sets the time zone of a user.
+	UpdateUserTimeZone(id int, timeZone string) error
 
 	// GetUser retrieves a user from the database.
 	GetUser(email string) (models.User, error)
 
-	// SaveReminder saves a reminder to the database.
-	SaveReminder(userId int, name, status, description, category, reminderInterval, reminderEnd string) error
+	// GetUserById retrieves a user from the database by its ID.
+	GetUserById(id int) (models.User, error)
+
+	// SaveReminder saves a new reminder to the database and fills in its
+	// generated ID and timestamps.
+	SaveReminder(reminder *models.Reminder) error
+
+	// UpdateReminder overwrites the editable fields of a reminder owned by
+	// reminder.UserID and bumps its updated_at. It returns sql.ErrNoRows if
+	// there is no such reminder.
+	UpdateReminder(reminder *models.Reminder) error
+
+	// DeleteReminder deletes a reminder owned by userId. It returns
+	// sql.ErrNoRows if there is no such reminder.
+	DeleteReminder(id, userId int) error
 
 	// GetReminderById retrieves a reminder from the database by its ID.
 	GetReminderById(id int) (models.Reminder, error)
@@ -41,12 +61,246 @@ type Service interface {
 
 	// GetAllReminders retrieves all reminders from the database.
 	GetAllReminders() ([]models.Reminder, error)
+
+	// GetDueReminders retrieves all pending reminders whose next fire time
+	// or snooze is at or before now. Reminders that have never been
+	// scheduled are included so the caller can compute their first fire
+	// time.
+	GetDueReminders(now time.Time) ([]models.Reminder, error)
+
+	// FireOccurrence claims an occurrence of a reminder and, in the same
+	// transaction, saves its deliveries with a job for each and records
+	// that the reminder fired. A snoozed occurrence clears the snooze and
+	// leaves the schedule alone; any other occurrence also moves the
+	// reminder on to next, where nil means it has no further occurrences.
+	// It returns sql.ErrNoRows if the occurrence was claimed before.
+	FireOccurrence(occurrence *models.Occurrence, deliveries []models.Delivery, next *time.Time) error
+
+	// SetReminderNextFire updates when a reminder should fire next without
+	// counting it as fired.
+	SetReminderNextFire(id int, next *time.Time) error
+
+	// UpdateReminderStatus sets the status of a reminder.
+	UpdateReminderStatus(id int, status string) error
+
+	// SnoozeReminder defers the occurrence of a reminder in status from
+	// that fired at occurrenceAt until until and keeps a record of it. A
+	// completed reminder is reopened with next as its next fire time. It
+	// returns sql.ErrNoRows if the reminder is no longer in status from.
+	SnoozeReminder(id int, from string, occurrenceAt *time.Time, until time.Time, next *time.Time) error
+
+	// GetReminderSnoozes retrieves the snooze history of a reminder, newest
+	// first.
+	GetReminderSnoozes(reminderId int) ([]models.Snooze, error)
+
+	// SaveChannel stores a new notification channel and sets its ID and
+	// creation time. Making it the default unsets the previous default.
+	SaveChannel(channel *models.Channel) error
+
+	// UpdateChannel updates the address, secret and flags of a notification
+	// channel of a user. Making it the default unsets the previous default.
+	// It returns sql.ErrNoRows if the user has no such channel.
+	UpdateChannel(channel *models.Channel) error
+
+	// GetChannel retrieves a notification channel of a user.
+	GetChannel(id, userId int) (models.Channel, error)
+
+	// GetChannelsForUser retrieves the notification channels of a user.
+	GetChannelsForUser(userId int) ([]models.Channel, error)
+
+	// DeleteChannel deletes a notification channel of a user. It returns
+	// sql.ErrNoRows if the user has no such channel.
+	DeleteChannel(id, userId int) error
+
+	// SaveTelegramLinkCode stores the hash of a code that links a Telegram
+	// chat to a user until expiresAt, replacing earlier codes of the user.
+	SaveTelegramLinkCode(userId int, codeHash string, expiresAt time.Time) error
+
+	// ConsumeTelegramLinkCode deletes a link code that has not expired by
+	// now and returns the user it belongs to. It returns sql.ErrNoRows if
+	// there is no such code.
+	ConsumeTelegramLinkCode(codeHash string, now time.Time) (int, error)
+
+	// SavePushSubscription stores a browser push subscription of a user and
+	// gives the user a Web Push channel if they have none. A browser that
+	// subscribes again replaces its previous subscription. It returns
+	// ErrPushSubscriptionTaken if the endpoint belongs to another user.
+	SavePushSubscription(subscription *models.PushSubscription) error
+
+	// GetPushSubscriptionsForUser retrieves the push subscriptions of a
+	// user.
+	GetPushSubscriptionsForUser(userId int) ([]models.PushSubscription, error)
+
+	// DeletePushSubscription deletes the push subscription with an
+	// endpoint. It returns sql.ErrNoRows if there is no such subscription.
+	DeletePushSubscription(endpoint string) error
+
+	// DeleteUserPushSubscription deletes a push subscription of a user. It
+	// returns sql.ErrNoRows if the user has no such subscription.
+	DeleteUserPushSubscription(endpoint string, userId int) error
+
+	// GetVAPIDKeys retrieves the stored VAPID key pair. It returns
+	// sql.ErrNoRows if none was stored yet.
+	GetVAPIDKeys() (public, private string, err error)
+
+	// SaveVAPIDKeys stores a VAPID key pair unless one is stored already.
+	SaveVAPIDKeys(public, private string) error
+
+	// RecordDeliveryAttempt stores the outcome of an attempt together with
+	// the resulting state of its delivery.
+	RecordDeliveryAttempt(delivery models.Delivery, attempt models.DeliveryAttempt) error
+
+	// GetDeliveries retrieves the deliveries matching filter, newest first.
+	GetDeliveries(filter models.DeliveryFilter) ([]models.Delivery, error)
+
+	// GetDelivery retrieves a delivery by ID.
+	GetDelivery(id int) (models.Delivery, error)
+
+	// GetDeliveryAttempts retrieves the attempts of a delivery in order.
+	GetDeliveryAttempts(deliveryId int) ([]models.DeliveryAttempt, error)
+
+	// RedriveDelivery makes a failed delivery pending again with a fresh
+	// set of attempts and queues its first attempt at now. It returns
+	// sql.ErrNoRows if there is no such failed delivery.
+	RedriveDelivery(id int, now time.Time) error
+
+	// ClaimJob locks the oldest job that is due at now and not held by
+	// another worker for worker until lockedUntil. Jobs locked by other
+	// transactions are skipped rather than waited for. It returns
+	// sql.ErrNoRows if no job is due.
+	ClaimJob(worker string, now, lockedUntil time.Time) (models.Job, error)
+
+	// CompleteJob deletes a job held by worker. It returns sql.ErrNoRows if
+	// worker no longer holds the job.
+	CompleteJob(id int, worker string) error
+
+	// RetryJob releases a job held by worker to run again at runAt. It
+	// returns sql.ErrNoRows if worker no longer holds the job.
+	RetryJob(id int, worker string, runAt time.Time, lastError string) error
+
+	// CreateSession stores a new session of a user together with the hash
+	// of its first refresh token and sets its ID.
+	CreateSession(session *models.Session, refreshTokenHash string) error
+
+	// GetSession retrieves a session by ID, including revoked and expired
+	// ones.
+	GetSession(id int) (models.Session, error)
+
+	// RotateRefreshToken exchanges a refresh token of an active session for
+	// a new one and extends the session until expiresAt. It returns
+	// sql.ErrNoRows if the token is unknown or its session has ended, and
+	// ErrRefreshTokenReused, after revoking the session, if the token was
+	// exchanged before.
+	RotateRefreshToken(tokenHash, newTokenHash string, now, expiresAt time.Time) (models.Session, error)
+
+	// RevokeSession ends a session at now. It returns sql.ErrNoRows if the
+	// session was already revoked.
+	RevokeSession(id int, now time.Time) error
+
+	// GetActiveSessionsForUser retrieves the sessions of a user that are
+	// neither revoked nor expired at now, most recently seen first.
+	GetActiveSessionsForUser(userId int, now time.Time) ([]models.Session, error)
+
+	// TouchSession records that a session was used from ip at now.
+	TouchSession(id int, ip string, now time.Time) error
+
+	// RevokeUserSession ends a session of a user at now. It returns
+	// sql.ErrNoRows if the user has no such active session.
+	RevokeUserSession(id, userId int, now time.Time) error
+
+	// RevokeOtherSessions ends every session of a user but keepId, which
+	// may be 0 to end them all, and returns how many it ended.
+	RevokeOtherSessions(userId, keepId int, now time.Time) (int, error)
+
+	// RevokeRefreshTokenSession ends the session a refresh token belongs
+	// to. It returns sql.ErrNoRows if there is no such active session.
+	RevokeRefreshTokenSession(tokenHash string, now time.Time) error
+
+	// SavePasswordResetToken stores the hash of a token issued at now that
+	// lets a user choose a new password until expiresAt, replacing earlier
+	// tokens of the user. It returns sql.ErrNoRows, and stores nothing, if
+	// the user was issued a token after since.
+	SavePasswordResetToken(userId int, tokenHash string, expiresAt, now, since time.Time) error
+
+	// ResetPassword consumes a reset token that has not expired by now,
+	// sets the password hash of its user and revokes every session of the
+	// user. It returns the user's ID, or sql.ErrNoRows if there is no such
+	// token.
+	ResetPassword(tokenHash, passHash string, now time.Time) (int, error)
+
+	// ClaimEmailVerification records that a verification email is sent to
+	// a user at now. It returns sql.ErrNoRows, and records nothing, if the
+	// address is verified already or another email was sent after since.
+	ClaimEmailVerification(userId int, now, since time.Time) error
+
+	// VerifyEmail marks the address of a user as verified at now, unless it
+	// was verified before. It returns sql.ErrNoRows if the user no longer
+	// has the address email.
+	VerifyEmail(userId int, email string, now time.Time) error
+
+	// SaveTOTPSecret stores a pending authenticator secret for a user,
+	// replacing an earlier pending one. It returns sql.ErrNoRows if the
+	// user has confirmed an authenticator already.
+	SaveTOTPSecret(userId int, secret string) error
+
+	// GetTOTP retrieves the authenticator of a user, pending or not.
+	GetTOTP(userId int) (models.TOTP, error)
+
+	// EnableTOTP confirms the pending authenticator of a user at now with
+	// the code for counter, and replaces their recovery codes. It returns
+	// sql.ErrNoRows if the user has no pending authenticator.
+	EnableTOTP(userId int, counter int64, recoveryCodeHashes []string, now time.Time) error
+
+	// DisableTOTP deletes the authenticator and recovery codes of a user.
+	// It returns sql.ErrNoRows if the user has no authenticator.
+	DisableTOTP(userId int) error
+
+	// UseTOTPCounter records that a code for counter was accepted from
+	// the enabled authenticator of a user. It returns sql.ErrNoRows if a
+	// code for the same or a later counter was accepted before.
+	UseTOTPCounter(userId int, counter int64) error
+
+	// UseRecoveryCode marks an unused recovery code of a user as used at
+	// now. It returns sql.ErrNoRows if the user has no such unused code.
+	UseRecoveryCode(userId int, codeHash string, now time.Time) error
+
+	// CreateMFAChallenge stores the hash of a token that lets a user who
+	// entered their password finish logging in with a second factor until
+	// expiresAt.
+	CreateMFAChallenge(userId int, tokenHash string, expiresAt time.Time) error
+
+	// AttemptMFAChallenge counts an attempt at a challenge that has not
+	// expired by now and returns the user it belongs to. It returns
+	// sql.ErrNoRows if there is no such challenge or maxAttempts were made
+	// already.
+	AttemptMFAChallenge(tokenHash string, now time.Time, maxAttempts int) (int, error)
+
+	// DeleteMFAChallenge deletes a challenge once it is passed. It returns
+	// sql.ErrNoRows if it was deleted already.
+	DeleteMFAChallenge(tokenHash string) error
+
+	// TransitionReminderStatus moves a reminder from one status to another.
+	// It returns sql.ErrNoRows if the reminder is no longer in status from.
+	TransitionReminderStatus(id int, from, to string) error
+
+	// ReopenReminder moves a reminder from status from back to pending and
+	// sets its next fire time in the same statement. It returns
+	// sql.ErrNoRows if the reminder is no longer in status from.
+	ReopenReminder(id int, from string, next *time.Time) error
 }
 
 type service struct {
 	db *sql.DB
 }
 
+// ErrRefreshTokenReused is returned for a refresh token that was already
+// exchanged, which means it was stolen or replayed.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// ErrPushSubscriptionTaken is returned for a push endpoint that another
+// user subscribed already.
+var ErrPushSubscriptionTaken = errors.New("push subscription belongs to another user")
+
 var (
 	database   = os.Getenv("BLUEPRINT_DB_DATABASE")
 	password   = os.Getenv("BLUEPRINT_DB_PASSWORD")
@@ -88,155 +342,1789 @@ func initDB(db *sql.DB) {
 	if err != nil {
 		log.Fatal(err)
 	}
-}
 
-func New() Service {
-	// Reuse Connection
-	if dbInstance != nil {
-		return dbInstance
+	_, err = db.Exec(`ALTER TABLE reminders
+		ADD COLUMN IF NOT EXISTS next_fire_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS last_fired_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS fire_count INT NOT NULL DEFAULT 0`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s", username, password, host, port, database, schema)
-	db, err := sql.Open("pgx", connStr)
+
+	_, err = db.Exec(`ALTER TABLE reminders
+		ALTER COLUMN reminder_interval SET DEFAULT '',
+		ALTER COLUMN reminder_end SET DEFAULT '',
+		ADD COLUMN IF NOT EXISTS starts_at TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS recurrence_frequency TEXT,
+		ADD COLUMN IF NOT EXISTS recurrence_interval INT,
+		ADD COLUMN IF NOT EXISTS recurrence_by_weekday TEXT,
+		ADD COLUMN IF NOT EXISTS recurrence_by_month_day TEXT,
+		ADD COLUMN IF NOT EXISTS recurrence_time_of_day TEXT,
+		ADD COLUMN IF NOT EXISTS recurrence_until TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS recurrence_count INT,
+		ADD COLUMN IF NOT EXISTS recurrence_error TEXT`)
+
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbInstance = &service{
-		db: db,
+
+	_, err = db.Exec(`ALTER TABLE reminders
+		ADD COLUMN IF NOT EXISTS recurrence_by_hour TEXT,
+		ADD COLUMN IF NOT EXISTS recurrence_by_minute TEXT,
+		ADD COLUMN IF NOT EXISTS recurrence_exdates TEXT,
+		ADD COLUMN IF NOT EXISTS recurrence_rdates TEXT`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	initDB(db)
+	_, err = db.Exec(`ALTER TABLE reminders
+		ADD COLUMN IF NOT EXISTS schedule_kind TEXT,
+		ADD COLUMN IF NOT EXISTS cron_expression TEXT`)
 
-	return dbInstance
-}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-// Health checks the health of the database connection by pinging the database.
-// It returns a map with keys indicating various health statistics.
-func (s *service) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS time_zone TEXT NOT NULL DEFAULT 'UTC'`)
 
-	stats := make(map[string]string)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE reminders
+		ADD COLUMN IF NOT EXISTS snoozed_until TIMESTAMPTZ,
+		ADD COLUMN IF NOT EXISTS snooze_count INT NOT NULL DEFAULT 0`)
 
-	// Ping the database
-	err := s.db.PingContext(ctx)
 	if err != nil {
-		stats["status"] = "down"
-		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf(fmt.Sprintf("db down: %v", err)) // Log the error and terminate the program
-		return stats
+		log.Fatal(err)
 	}
 
-	// Database is up, add more statistics
-	stats["status"] = "up"
-	stats["message"] = "It's healthy"
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS reminder_snoozes (
+		id SERIAL PRIMARY KEY,
+		reminder_id INT NOT NULL REFERENCES reminders (id) ON DELETE CASCADE,
+		occurrence_at TIMESTAMPTZ,
+		snoozed_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		snoozed_until TIMESTAMPTZ NOT NULL
+	)`)
 
-	// Get database stats (like open connections, in use, idle, etc.)
-	dbStats := s.db.Stats()
-	stats["open_connections"] = strconv.Itoa(dbStats.OpenConnections)
-	stats["in_use"] = strconv.Itoa(dbStats.InUse)
-	stats["idle"] = strconv.Itoa(dbStats.Idle)
-	stats["wait_count"] = strconv.FormatInt(dbStats.WaitCount, 10)
-	stats["wait_duration"] = dbStats.WaitDuration.String()
-	stats["max_idle_closed"] = strconv.FormatInt(dbStats.MaxIdleClosed, 10)
-	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeClosed, 10)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Evaluate stats to provide a health message
-	if dbStats.OpenConnections > 40 { // Assuming 50 is the max for this example
-		stats["message"] = "The database is experiencing heavy load."
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS notification_channels (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		address TEXT NOT NULL,
+		secret TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if dbStats.WaitCount > 1000 {
-		stats["message"] = "The database has a high number of wait events, indicating potential bottlenecks."
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS telegram_link_codes (
+		code_hash TEXT PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		expires_at TIMESTAMPTZ NOT NULL
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if dbStats.MaxIdleClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many idle connections are being closed, consider revising the connection pool settings."
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS push_subscriptions (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		endpoint TEXT UNIQUE NOT NULL,
+		p256dh TEXT NOT NULL,
+		auth TEXT NOT NULL,
+		user_agent TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if dbStats.MaxLifetimeClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
+	// The single VAPID key pair the server signs push requests with
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS vapid_keys (
+		id INT PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+		public_key TEXT NOT NULL,
+		private_key TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	return stats
-}
+	// Email and Web Push used to be delivered without a channel; the first
+	// start with channel preferences registers them as channels once
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'notification_channels' AND column_name = 'enabled' AND table_schema = current_schema()) THEN
+			ALTER TABLE notification_channels
+				ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT true,
+				ADD COLUMN is_default BOOLEAN NOT NULL DEFAULT false;
 
-// Close closes the database connection.
-// It logs a message indicating the disconnection from the specific database.
-// If the connection is successfully closed, it returns nil.
-// If an error occurs while closing the connection, it returns the error.
-func (s *service) Close() error {
-	log.Printf("Disconnected from database: %s", database)
-	return s.db.Close()
-}
+			INSERT INTO notification_channels (user_id, kind, address)
+				SELECT id, 'email', email FROM users;
+
+			INSERT INTO notification_channels (user_id, kind, address)
+				SELECT DISTINCT user_id, 'webpush', '' FROM push_subscriptions;
+		END IF;
+	END $$`)
 
-func (s *service) SaveUser(email, pass, fname, lname string) error {
-	_, err := s.db.Exec("INSERT INTO users (email, pass, fname, lname) VALUES ($1, $2, $3, $4)", email, pass, fname, lname)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-	return nil
-}
 
-func (s *service) GetUser(email string) (models.User, error) {
-	var user models.User
-	err := s.db.QueryRow("SELECT * FROM users WHERE email = $1", email).Scan(&user.ID, &user.Email, &user.Pass, &user.Fname, &user.Lname)
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS notification_channels_default_idx
+		ON notification_channels (user_id) WHERE is_default`)
+
 	if err != nil {
-		return user, err
+		log.Fatal(err)
 	}
-	return user, nil
-}
 
-func (s *service) SaveReminder(userId int, name, status, description, category, reminderInterval, reminderEnd string) error {
-	_, err := s.db.Exec("INSERT INTO reminders (user_id, name, status, description, category, reminder_interval, reminder_end) VALUES ($1, $2, $3, $4, $5, $6, $7)", userId, name, status, description, category, reminderInterval, reminderEnd)
+	_, err = db.Exec(`ALTER TABLE reminders
+		ADD COLUMN IF NOT EXISTS channel_id INT REFERENCES notification_channels (id) ON DELETE SET NULL`)
+
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-	return nil
-}
 
-func (s *service) GetReminderById(id int) (models.Reminder, error) {
-	var reminder models.Reminder
-	err := s.db.QueryRow("SELECT * FROM reminders WHERE id = $1", id).Scan(&reminder.ID, &reminder.UserID, &reminder.Name, &reminder.Status, &reminder.Description, &reminder.Category, &reminder.CreatedAt, &reminder.UpdatedAt, &reminder.ReminderInterval, &reminder.ReminderEnd)
+	// One row per fired occurrence and channel, retried until it is
+	// delivered or dead-lettered as failed
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS deliveries (
+		id SERIAL PRIMARY KEY,
+		reminder_id INT NOT NULL REFERENCES reminders (id) ON DELETE CASCADE,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		channel_id INT REFERENCES notification_channels (id) ON DELETE SET NULL,
+		channel_kind TEXT NOT NULL,
+		fired_at TIMESTAMPTZ NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INT NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at TIMESTAMPTZ,
+		delivered_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
 	if err != nil {
-		return reminder, err
+		log.Fatal(err)
 	}
-	return reminder, nil
-}
 
-func (s *service) GetAllRemindersForUser(userId int) ([]models.Reminder, error) {
-	rows, err := s.db.Query("SELECT * FROM reminders WHERE user_id = $1", userId)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS delivery_attempts (
+		id SERIAL PRIMARY KEY,
+		delivery_id INT NOT NULL REFERENCES deliveries (id) ON DELETE CASCADE,
+		attempt INT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		attempted_at TIMESTAMPTZ NOT NULL
+	)`)
+
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
-	defer rows.Close()
 
-	var reminders []models.Reminder = []models.Reminder{}
-	for rows.Next() {
-		var reminder models.Reminder
-		err := rows.Scan(&reminder.ID, &reminder.UserID, &reminder.Name, &reminder.Status, &reminder.Description, &reminder.Category, &reminder.CreatedAt, &reminder.UpdatedAt, &reminder.ReminderInterval, &reminder.ReminderEnd)
-		if err != nil {
-			return nil, err
-		}
-		reminders = append(reminders, reminder)
+	// Background work claimed by queue workers under a lease. Deliveries
+	// that were pending before the queue existed are queued once
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF to_regclass('jobs') IS NULL THEN
+			CREATE TABLE jobs (
+				id SERIAL PRIMARY KEY,
+				kind TEXT NOT NULL,
+				payload JSONB NOT NULL DEFAULT '{}',
+				run_at TIMESTAMPTZ NOT NULL,
+				attempts INT NOT NULL DEFAULT 0,
+				locked_by TEXT,
+				locked_until TIMESTAMPTZ,
+				last_error TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+
+			CREATE INDEX jobs_run_at_idx ON jobs (run_at);
+
+			INSERT INTO jobs (kind, payload, run_at)
+				SELECT 'delivery', jsonb_build_object('delivery_id', id), next_attempt_at
+				FROM deliveries WHERE status = 'pending';
+		END IF;
+	END $$`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
-	return reminders, nil
-}
 
-func (s *service) GetAllReminders() ([]models.Reminder, error) {
-	rows, err := s.db.Query("SELECT * FROM reminders")
+	// Each occurrence of a reminder is claimed here before it is delivered,
+	// so concurrent dispatchers cannot fire it twice
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS occurrences (
+		id SERIAL PRIMARY KEY,
+		reminder_id INT NOT NULL REFERENCES reminders (id) ON DELETE CASCADE,
+		scheduled_at TIMESTAMPTZ NOT NULL,
+		snoozed BOOLEAN NOT NULL DEFAULT false,
+		fired_at TIMESTAMPTZ NOT NULL,
+		UNIQUE (reminder_id, scheduled_at)
+	)`)
+
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
-	defer rows.Close()
 
-	var reminders []models.Reminder = []models.Reminder{}
-	for rows.Next() {
-		var reminder models.Reminder
-		err := rows.Scan(&reminder.ID, &reminder.UserID, &reminder.Name, &reminder.Status, &reminder.Description, &reminder.Category, &reminder.CreatedAt, &reminder.UpdatedAt, &reminder.ReminderInterval, &reminder.ReminderEnd)
-		if err != nil {
-			return nil, err
-		}
-		reminders = append(reminders, reminder)
+	_, err = db.Exec(`ALTER TABLE deliveries
+		ADD COLUMN IF NOT EXISTS occurrence_id INT REFERENCES occurrences (id) ON DELETE CASCADE`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A session is a refresh token family; only the hash of each refresh
+	// token is stored
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sessions (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMPTZ NOT NULL,
+		revoked_at TIMESTAMPTZ
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id SERIAL PRIMARY KEY,
+		session_id INT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		used_at TIMESTAMPTZ
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+		token_hash TEXT PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		expires_at TIMESTAMPTZ NOT NULL
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS totp_credentials (
+		user_id INT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+		secret TEXT NOT NULL,
+		enabled_at TIMESTAMPTZ,
+		last_counter BIGINT,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS recovery_codes (
+		id SERIAL PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		code_hash TEXT NOT NULL,
+		used_at TIMESTAMPTZ,
+		UNIQUE (user_id, code_hash)
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS mfa_challenges (
+		token_hash TEXT PRIMARY KEY,
+		user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		expires_at TIMESTAMPTZ NOT NULL,
+		attempts INT NOT NULL DEFAULT 0
+	)`)
+
+	if err != nil {
+		log.Fatal(err)
 	}
-	return reminders, nil
+
+	// Accounts created before addresses were verified keep working
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'users' AND column_name = 'email_verified_at' AND table_schema = current_schema()) THEN
+			ALTER TABLE users
+				ADD COLUMN email_verified_at TIMESTAMPTZ,
+				ADD COLUMN email_verification_sent_at TIMESTAMPTZ;
+
+			UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
+		END IF;
+	END $$`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Deliveries remember whether their occurrence came from a snooze, as
+	// firing it clears the reminder's snoozed_until
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'deliveries' AND column_name = 'snoozed' AND table_schema = current_schema()) THEN
+			ALTER TABLE deliveries ADD COLUMN snoozed BOOLEAN NOT NULL DEFAULT false;
+
+			UPDATE deliveries SET snoozed = occurrences.snoozed
+				FROM occurrences WHERE occurrences.id = deliveries.occurrence_id;
+		END IF;
+	END $$`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Deliveries keep the time their occurrence was scheduled for, which
+	// webhooks report
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'deliveries' AND column_name = 'scheduled_at' AND table_schema = current_schema()) THEN
+			ALTER TABLE deliveries ADD COLUMN scheduled_at TIMESTAMPTZ;
+
+			UPDATE deliveries SET scheduled_at = COALESCE(
+				(SELECT occurrences.scheduled_at FROM occurrences WHERE occurrences.id = deliveries.occurrence_id), fired_at);
+
+			ALTER TABLE deliveries ALTER COLUMN scheduled_at SET NOT NULL;
+		END IF;
+	END $$`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Reset tokens record when they were issued so they are not reissued
+	// too often
+	_, err = db.Exec(`ALTER TABLE password_reset_tokens
+		ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user'`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE reminders ADD COLUMN IF NOT EXISTS time_zone TEXT`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// created_at and updated_at used to be stored without a time zone,
+	// in the UTC session zone of the database container
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF (SELECT data_type FROM information_schema.columns
+			WHERE table_name = 'reminders' AND column_name = 'created_at' AND table_schema = current_schema()) = 'timestamp without time zone' THEN
+			ALTER TABLE reminders
+				ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+				ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at AT TIME ZONE 'UTC';
+		END IF;
+	END $$`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`UPDATE reminders SET starts_at = created_at WHERE starts_at IS NULL`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrateLegacyRecurrences(db)
+
+	// Statuses used to be free text
+	_, err = db.Exec(`UPDATE reminders SET status = CASE
+			WHEN lower(trim(status)) IN ('completed', 'done') THEN 'completed'
+			WHEN lower(trim(status)) IN ('cancelled', 'canceled') THEN 'cancelled'
+			ELSE 'pending'
+		END
+		WHERE status NOT IN ('pending', 'completed', 'cancelled')`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'reminders_status_check') THEN
+			ALTER TABLE reminders ADD CONSTRAINT reminders_status_check CHECK (status IN ('pending', 'completed', 'cancelled'));
+		END IF;
+	END $$`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = db.Exec(`UPDATE reminders SET schedule_kind = CASE WHEN recurrence_frequency IS NULL THEN 'once' ELSE 'recurrence' END
+		WHERE schedule_kind IS NULL`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// migrateLegacyRecurrences converts the free text reminder_interval and
+// reminder_end of reminders created before recurrences were structured.
+// Rows that cannot be parsed are flagged through recurrence_error.
+func migrateLegacyRecurrences(db *sql.DB) {
+	rows, err := db.Query(`SELECT id, reminder_interval, reminder_end FROM reminders
+		WHERE recurrence_frequency IS NULL AND recurrence_error IS NULL AND reminder_interval <> ''`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	type legacyReminder struct {
+		id       int
+		interval string
+		end      string
+	}
+
+	var legacy []legacyReminder
+	for rows.Next() {
+		var r legacyReminder
+		if err := rows.Scan(&r.id, &r.interval, &r.end); err != nil {
+			log.Fatal(err)
+		}
+		legacy = append(legacy, r)
+	}
+	rows.Close()
+
+	for _, r := range legacy {
+		rec, err := recurrence.ParseLegacy(r.interval, r.end)
+		if err != nil {
+			fmt.Printf("Cannot migrate recurrence of reminder %d: %v\n", r.id, err)
+			_, err = db.Exec("UPDATE reminders SET recurrence_error = $2 WHERE id = $1", r.id, err.Error())
+		} else {
+			_, err = db.Exec(`UPDATE reminders SET recurrence_frequency = $2, recurrence_interval = $3,
+				recurrence_by_weekday = $4, recurrence_by_month_day = $5, recurrence_time_of_day = $6,
+				recurrence_until = $7, recurrence_count = $8, recurrence_by_hour = $9, recurrence_by_minute = $10,
+				recurrence_exdates = $11, recurrence_rdates = $12 WHERE id = $1`, append([]any{r.id}, recurrenceArgs(&rec)...)...)
+		}
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func New() Service {
+	// Reuse Connection
+	if dbInstance != nil {
+		return dbInstance
+	}
+	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s", username, password, host, port, database, schema)
+	db, err := sql.Open("pgx", connStr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbInstance = &service{
+		db: db,
+	}
+
+	initDB(db)
+
+	return dbInstance
+}
+
+// Health checks the health of the database connection by pinging the database.
+// It returns a map with keys indicating various health statistics.
+func (s *service) Health() map[string]string {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	stats := make(map[string]string)
+
+	// Ping the database
+	err := s.db.PingContext(ctx)
+	if err != nil {
+		stats["status"] = "down"
+		stats["error"] = fmt.Sprintf("db down: %v", err)
+		log.Fatalf(fmt.Sprintf("db down: %v", err)) // Log the error and terminate the program
+		return stats
+	}
+
+	// Database is up, add more statistics
+	stats["status"] = "up"
+	stats["message"] = "It's healthy"
+
+	// Get database stats (like open connections, in use, idle, etc.)
+	dbStats := s.db.Stats()
+	stats["open_connections"] = strconv.Itoa(dbStats.OpenConnections)
+	stats["in_use"] = strconv.Itoa(dbStats.InUse)
+	stats["idle"] = strconv.Itoa(dbStats.Idle)
+	stats["wait_count"] = strconv.FormatInt(dbStats.WaitCount, 10)
+	stats["wait_duration"] = dbStats.WaitDuration.String()
+	stats["max_idle_closed"] = strconv.FormatInt(dbStats.MaxIdleClosed, 10)
+	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeClosed, 10)
+
+	// Evaluate stats to provide a health message
+	if dbStats.OpenConnections > 40 { // Assuming 50 is the max for this example
+		stats["message"] = "The database is experiencing heavy load."
+	}
+
+	if dbStats.WaitCount > 1000 {
+		stats["message"] = "The database has a high number of wait events, indicating potential bottlenecks."
+	}
+
+	if dbStats.MaxIdleClosed > int64(dbStats.OpenConnections)/2 {
+		stats["message"] = "Many idle connections are being closed, consider revising the connection pool settings."
+	}
+
+	if dbStats.MaxLifetimeClosed > int64(dbStats.OpenConnections)/2 {
+		stats["message"] = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
+	}
+
+	return stats
+}
+
+// Close closes the database connection.
+// It logs a message indicating the disconnection from the specific database.
+// If the connection is successfully closed, it returns nil.
+// If an error occurs while closing the connection, it returns the error.
+func (s *service) Close() error {
+	log.Printf("Disconnected from database: %s", database)
+	return s.db.Close()
+}
+
+func (s *service) SaveUser(email, pass, fname, lname, timeZone string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow("INSERT INTO users (email, pass, fname, lname, time_zone) VALUES ($1, $2, $3, $4, $5) RETURNING id", email, pass, fname, lname, timeZone).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO notification_channels (user_id, kind, address) VALUES ($1, 'email', $2)", id, email)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) GetUser(email string) (models.User, error) {
+	var user models.User
+	err := s.db.QueryRow("SELECT id, email, pass, fname, lname, time_zone, role, email_verified_at FROM users WHERE email = $1", email).Scan(&user.ID, &user.Email, &user.Pass, &user.Fname, &user.Lname, &user.TimeZone, &user.Role, &user.EmailVerifiedAt)
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+func (s *service) GetUserById(id int) (models.User, error) {
+	var user models.User
+	err := s.db.QueryRow("SELECT id, email, pass, fname, lname, time_zone, role, email_verified_at FROM users WHERE id = $1", id).Scan(&user.ID, &user.Email, &user.Pass, &user.Fname, &user.Lname, &user.TimeZone, &user.Role, &user.EmailVerifiedAt)
+	if err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+func (s *service) UpdateUserTimeZone(id int, timeZone string) error {
+	_, err := s.db.Exec("UPDATE users SET time_zone = $2 WHERE id = $1", id, timeZone)
+	return err
+}
+
+func (s *service) SaveReminder(reminder *models.Reminder) error {
+	args := []any{reminder.UserID, reminder.Name, reminder.Status, reminder.Description, reminder.Category, reminder.ReminderInterval, reminder.ReminderEnd, reminder.StartsAt, reminder.NextFireAt, reminder.ScheduleKind, nullIfEmpty(reminder.CronExpression), nullIfEmpty(reminder.TimeZone)}
+	args = append(args, recurrenceArgs(reminder.Recurrence)...)
+	args = append(args, reminder.ChannelID)
+
+	return s.db.QueryRow(`INSERT INTO reminders (user_id, name, status, description, category, reminder_interval, reminder_end, starts_at, next_fire_at,
+		schedule_kind, cron_expression, time_zone,
+		recurrence_frequency, recurrence_interval, recurrence_by_weekday, recurrence_by_month_day, recurrence_time_of_day, recurrence_until, recurrence_count,
+		recurrence_by_hour, recurrence_by_minute, recurrence_exdates, recurrence_rdates, channel_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)
+		RETURNING id, created_at, updated_at`, args...).Scan(&reminder.ID, &reminder.CreatedAt, &reminder.UpdatedAt)
+}
+
+func (s *service) UpdateReminder(reminder *models.Reminder) error {
+	args := []any{reminder.ID, reminder.UserID, reminder.Name, reminder.Status, reminder.Description, reminder.Category, reminder.ReminderInterval, reminder.ReminderEnd, reminder.StartsAt, reminder.NextFireAt, reminder.ScheduleKind, nullIfEmpty(reminder.CronExpression), nullIfEmpty(reminder.TimeZone)}
+	args = append(args, recurrenceArgs(reminder.Recurrence)...)
+	args = append(args, nullIfEmpty(reminder.RecurrenceError), reminder.ChannelID)
+
+	return s.db.QueryRow(`UPDATE reminders SET name = $3, status = $4, description = $5, category = $6, reminder_interval = $7, reminder_end = $8,
+		starts_at = $9, next_fire_at = $10, schedule_kind = $11, cron_expression = $12, time_zone = $13,
+		recurrence_frequency = $14, recurrence_interval = $15, recurrence_by_weekday = $16, recurrence_by_month_day = $17, recurrence_time_of_day = $18,
+		recurrence_until = $19, recurrence_count = $20, recurrence_by_hour = $21, recurrence_by_minute = $22, recurrence_exdates = $23, recurrence_rdates = $24,
+		recurrence_error = $25, channel_id = $26, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2
+		RETURNING updated_at`, args...).Scan(&reminder.UpdatedAt)
+}
+
+func (s *service) DeleteReminder(id, userId int) error {
+	result, err := s.db.Exec("DELETE FROM reminders WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// reminderColumns lists the reminder columns in the order scanReminder expects.
+const reminderColumns = `id, user_id, name, status, description, category, created_at, updated_at,
+	reminder_interval, reminder_end, next_fire_at, last_fired_at, fire_count, starts_at,
+	recurrence_frequency, recurrence_interval, recurrence_by_weekday, recurrence_by_month_day,
+	recurrence_time_of_day, recurrence_until, recurrence_count, recurrence_error,
+	recurrence_by_hour, recurrence_by_minute, recurrence_exdates, recurrence_rdates,
+	schedule_kind, cron_expression, time_zone, snoozed_until, snooze_count, channel_id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanReminder(row rowScanner) (models.Reminder, error) {
+	var reminder models.Reminder
+	var (
+		frequency, byWeekday, byMonthDay, timeOfDay, recurrenceError *string
+		byHour, byMinute, exDates, rDates                            *string
+		scheduleKind, cronExpression, timeZone                       *string
+		interval, count                                              *int
+		until                                                        *time.Time
+	)
+
+	err := row.Scan(&reminder.ID, &reminder.UserID, &reminder.Name, &reminder.Status, &reminder.Description, &reminder.Category, &reminder.CreatedAt, &reminder.UpdatedAt, &reminder.ReminderInterval, &reminder.ReminderEnd, &reminder.NextFireAt, &reminder.LastFiredAt, &reminder.FireCount, &reminder.StartsAt,
+		&frequency, &interval, &byWeekday, &byMonthDay, &timeOfDay, &until, &count, &recurrenceError,
+		&byHour, &byMinute, &exDates, &rDates, &scheduleKind, &cronExpression, &timeZone, &reminder.SnoozedUntil, &reminder.SnoozeCount, &reminder.ChannelID)
+	if err != nil {
+		return reminder, err
+	}
+
+	if scheduleKind != nil {
+		reminder.ScheduleKind = *scheduleKind
+	}
+
+	if cronExpression != nil {
+		reminder.CronExpression = *cronExpression
+	}
+
+	if timeZone != nil {
+		reminder.TimeZone = *timeZone
+	}
+
+	if recurrenceError != nil {
+		reminder.RecurrenceError = *recurrenceError
+	}
+
+	if frequency == nil {
+		return reminder, nil
+	}
+
+	rec := &recurrence.Recurrence{
+		Frequency: recurrence.Frequency(*frequency),
+		Until:     until,
+	}
+	if interval != nil {
+		rec.Interval = *interval
+	}
+	if count != nil {
+		rec.Count = *count
+	}
+	if timeOfDay != nil {
+		rec.TimeOfDay = *timeOfDay
+	}
+	if byWeekday != nil {
+		if rec.ByWeekday, err = recurrence.ParseWeekdays(*byWeekday); err != nil {
+			return reminder, err
+		}
+	}
+	if byMonthDay != nil {
+		if rec.ByMonthDay, err = parseInts(*byMonthDay); err != nil {
+			return reminder, err
+		}
+	}
+	if byHour != nil {
+		if rec.ByHour, err = parseInts(*byHour); err != nil {
+			return reminder, err
+		}
+	}
+	if byMinute != nil {
+		if rec.ByMinute, err = parseInts(*byMinute); err != nil {
+			return reminder, err
+		}
+	}
+	if exDates != nil {
+		if rec.ExDates, err = parseTimes(*exDates); err != nil {
+			return reminder, err
+		}
+	}
+	if rDates != nil {
+		if rec.RDates, err = parseTimes(*rDates); err != nil {
+			return reminder, err
+		}
+	}
+	reminder.Recurrence = rec
+
+	return reminder, nil
+}
+
+// recurrenceArgs returns the values of the recurrence_frequency,
+// recurrence_interval, recurrence_by_weekday, recurrence_by_month_day,
+// recurrence_time_of_day, recurrence_until, recurrence_count,
+// recurrence_by_hour, recurrence_by_minute, recurrence_exdates and
+// recurrence_rdates columns.
+func recurrenceArgs(rec *recurrence.Recurrence) []any {
+	if rec == nil {
+		return []any{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}
+	}
+
+	return []any{
+		string(rec.Frequency),
+		max(rec.Interval, 1),
+		nullIfEmpty(recurrence.FormatWeekdays(rec.ByWeekday)),
+		nullIfEmpty(formatInts(rec.ByMonthDay)),
+		nullIfEmpty(rec.TimeOfDay),
+		rec.Until,
+		rec.Count,
+		nullIfEmpty(formatInts(rec.ByHour)),
+		nullIfEmpty(formatInts(rec.ByMinute)),
+		nullIfEmpty(formatTimes(rec.ExDates)),
+		nullIfEmpty(formatTimes(rec.RDates)),
+	}
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func formatInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatTimes(values []time.Time) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = v.Format(time.RFC3339)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseTimes(s string) ([]time.Time, error) {
+	var values []time.Time
+	for _, part := range strings.Split(s, ",") {
+		v, err := time.Parse(time.RFC3339, part)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (s *service) queryReminders(query string, args ...any) ([]models.Reminder, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []models.Reminder = []models.Reminder{}
+	for rows.Next() {
+		reminder, err := scanReminder(rows)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	return reminders, rows.Err()
+}
+
+func (s *service) GetReminderById(id int) (models.Reminder, error) {
+	return scanReminder(s.db.QueryRow("SELECT "+reminderColumns+" FROM reminders WHERE id = $1", id))
+}
+
+func (s *service) GetAllRemindersForUser(userId int) ([]models.Reminder, error) {
+	return s.queryReminders("SELECT "+reminderColumns+" FROM reminders WHERE user_id = $1", userId)
+}
+
+func (s *service) GetAllReminders() ([]models.Reminder, error) {
+	return s.queryReminders("SELECT " + reminderColumns + " FROM reminders")
+}
+
+func (s *service) GetDueReminders(now time.Time) ([]models.Reminder, error) {
+	return s.queryReminders("SELECT "+reminderColumns+" FROM reminders WHERE status = 'pending' AND (next_fire_at IS NULL OR next_fire_at <= $1 OR snoozed_until <= $1) ORDER BY next_fire_at NULLS FIRST, id", now)
+}
+
+func (s *service) FireOccurrence(occurrence *models.Occurrence, deliveries []models.Delivery, next *time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`INSERT INTO occurrences (reminder_id, scheduled_at, snoozed, fired_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (reminder_id, scheduled_at) DO NOTHING RETURNING id`,
+		occurrence.ReminderID, occurrence.ScheduledAt, occurrence.Snoozed, occurrence.FiredAt).Scan(&occurrence.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		delivery.OccurrenceID = &occurrence.ID
+
+		err := tx.QueryRow(`INSERT INTO deliveries (reminder_id, occurrence_id, user_id, channel_id, channel_kind, scheduled_at, fired_at, snoozed, status, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at, updated_at`,
+			delivery.ReminderID, delivery.OccurrenceID, delivery.UserID, delivery.ChannelID, delivery.ChannelKind, delivery.ScheduledAt, delivery.FiredAt, delivery.Snoozed, delivery.Status, delivery.NextAttemptAt).Scan(&delivery.ID, &delivery.CreatedAt, &delivery.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if err := enqueueDelivery(tx, delivery.ID, *delivery.NextAttemptAt); err != nil {
+			return err
+		}
+	}
+
+	if occurrence.Snoozed {
+		_, err = tx.Exec("UPDATE reminders SET last_fired_at = $2, fire_count = fire_count + 1, snoozed_until = NULL WHERE id = $1", occurrence.ReminderID, occurrence.FiredAt)
+	} else {
+		_, err = tx.Exec("UPDATE reminders SET last_fired_at = $2, next_fire_at = $3, fire_count = fire_count + 1, snoozed_until = NULL WHERE id = $1", occurrence.ReminderID, occurrence.FiredAt, next)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) SnoozeReminder(id int, from string, occurrenceAt *time.Time, until time.Time, next *time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The schedule of a pending reminder is left to the dispatcher
+	result, err := tx.Exec(`UPDATE reminders SET snoozed_until = $3, snooze_count = snooze_count + 1,
+			next_fire_at = CASE WHEN status = $4 THEN $5 ELSE next_fire_at END, status = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $2`, id, from, until, models.StatusCompleted, next, models.StatusPending)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec("INSERT INTO reminder_snoozes (reminder_id, occurrence_at, snoozed_until) VALUES ($1, $2, $3)", id, occurrenceAt, until)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) GetReminderSnoozes(reminderId int) ([]models.Snooze, error) {
+	rows, err := s.db.Query("SELECT id, reminder_id, occurrence_at, snoozed_at, snoozed_until FROM reminder_snoozes WHERE reminder_id = $1 ORDER BY snoozed_at DESC, id DESC", reminderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snoozes []models.Snooze = []models.Snooze{}
+	for rows.Next() {
+		var snooze models.Snooze
+		err := rows.Scan(&snooze.ID, &snooze.ReminderID, &snooze.OccurrenceAt, &snooze.SnoozedAt, &snooze.SnoozedUntil)
+		if err != nil {
+			return nil, err
+		}
+		snoozes = append(snoozes, snooze)
+	}
+	return snoozes, rows.Err()
+}
+
+func (s *service) SetReminderNextFire(id int, next *time.Time) error {
+	_, err := s.db.Exec("UPDATE reminders SET next_fire_at = $2 WHERE id = $1", id, next)
+	return err
+}
+
+func (s *service) UpdateReminderStatus(id int, status string) error {
+	_, err := s.db.Exec("UPDATE reminders SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1", id, status)
+	return err
+}
+
+func (s *service) TransitionReminderStatus(id int, from, to string) error {
+	return s.execTransition("UPDATE reminders SET status = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $2", id, from, to)
+}
+
+func (s *service) ReopenReminder(id int, from string, next *time.Time) error {
+	return s.execTransition("UPDATE reminders SET status = $3, next_fire_at = $4, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND status = $2",
+		id, from, models.StatusPending, next)
+}
+
+// execTransition runs a status change that only applies while the
+// reminder is in the expected status and returns sql.ErrNoRows if it is
+// not.
+func (s *service) execTransition(query string, args ...any) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const channelColumns = "id, user_id, kind, address, secret, enabled, is_default, created_at"
+
+func scanChannel(row rowScanner) (models.Channel, error) {
+	var channel models.Channel
+	err := row.Scan(&channel.ID, &channel.UserID, &channel.Kind, &channel.Address, &channel.Secret, &channel.Enabled, &channel.IsDefault, &channel.CreatedAt)
+	return channel, err
+}
+
+// clearDefaultChannel unsets the default channel of a user so another
+// one can become the default.
+func clearDefaultChannel(tx *sql.Tx, userId, except int) error {
+	_, err := tx.Exec("UPDATE notification_channels SET is_default = false WHERE user_id = $1 AND id <> $2 AND is_default", userId, except)
+	return err
+}
+
+func (s *service) SaveChannel(channel *models.Channel) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if channel.IsDefault {
+		if err := clearDefaultChannel(tx, channel.UserID, 0); err != nil {
+			return err
+		}
+	}
+
+	err = tx.QueryRow("INSERT INTO notification_channels (user_id, kind, address, secret, enabled, is_default) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at",
+		channel.UserID, channel.Kind, channel.Address, channel.Secret, channel.Enabled, channel.IsDefault).Scan(&channel.ID, &channel.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) UpdateChannel(channel *models.Channel) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if channel.IsDefault {
+		if err := clearDefaultChannel(tx, channel.UserID, channel.ID); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec("UPDATE notification_channels SET address = $3, secret = $4, enabled = $5, is_default = $6 WHERE id = $1 AND user_id = $2",
+		channel.ID, channel.UserID, channel.Address, channel.Secret, channel.Enabled, channel.IsDefault)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) GetChannel(id, userId int) (models.Channel, error) {
+	return scanChannel(s.db.QueryRow("SELECT "+channelColumns+" FROM notification_channels WHERE id = $1 AND user_id = $2", id, userId))
+}
+
+func (s *service) GetChannelsForUser(userId int) ([]models.Channel, error) {
+	rows, err := s.db.Query("SELECT "+channelColumns+" FROM notification_channels WHERE user_id = $1 ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []models.Channel = []models.Channel{}
+	for rows.Next() {
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
+func (s *service) DeleteChannel(id, userId int) error {
+	result, err := s.db.Exec("DELETE FROM notification_channels WHERE id = $1 AND user_id = $2", id, userId)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *service) SaveTelegramLinkCode(userId int, codeHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM telegram_link_codes WHERE user_id = $1 OR expires_at <= CURRENT_TIMESTAMP", userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO telegram_link_codes (code_hash, user_id, expires_at) VALUES ($1, $2, $3)", codeHash, userId, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) ConsumeTelegramLinkCode(codeHash string, now time.Time) (int, error) {
+	var userId int
+	err := s.db.QueryRow("DELETE FROM telegram_link_codes WHERE code_hash = $1 AND expires_at > $2 RETURNING user_id", codeHash, now).Scan(&userId)
+	return userId, err
+}
+
+func (s *service) SavePushSubscription(subscription *models.PushSubscription) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (endpoint) DO UPDATE SET p256dh = $3, auth = $4, user_agent = $5, created_at = CURRENT_TIMESTAMP
+		WHERE push_subscriptions.user_id = $1
+		RETURNING id, created_at`,
+		subscription.UserID, subscription.Endpoint, subscription.P256dh, subscription.Auth, subscription.UserAgent).Scan(&subscription.ID, &subscription.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPushSubscriptionTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO notification_channels (user_id, kind, address)
+		SELECT $1, 'webpush', '' WHERE NOT EXISTS (SELECT 1 FROM notification_channels WHERE user_id = $1 AND kind = 'webpush')`, subscription.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) GetPushSubscriptionsForUser(userId int) ([]models.PushSubscription, error) {
+	rows, err := s.db.Query("SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at FROM push_subscriptions WHERE user_id = $1 ORDER BY id", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []models.PushSubscription = []models.PushSubscription{}
+	for rows.Next() {
+		var subscription models.PushSubscription
+		err := rows.Scan(&subscription.ID, &subscription.UserID, &subscription.Endpoint, &subscription.P256dh, &subscription.Auth, &subscription.UserAgent, &subscription.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (s *service) DeletePushSubscription(endpoint string) error {
+	return s.deletePushSubscriptions("DELETE FROM push_subscriptions WHERE endpoint = $1", endpoint)
+}
+
+func (s *service) DeleteUserPushSubscription(endpoint string, userId int) error {
+	return s.deletePushSubscriptions("DELETE FROM push_subscriptions WHERE endpoint = $1 AND user_id = $2", endpoint, userId)
+}
+
+func (s *service) deletePushSubscriptions(query string, args ...any) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *service) GetVAPIDKeys() (public, private string, err error) {
+	err = s.db.QueryRow("SELECT public_key, private_key FROM vapid_keys WHERE id = 1").Scan(&public, &private)
+	return public, private, err
+}
+
+func (s *service) SaveVAPIDKeys(public, private string) error {
+	_, err := s.db.Exec("INSERT INTO vapid_keys (public_key, private_key) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING", public, private)
+	return err
+}
+
+const deliveryColumns = "id, reminder_id, occurrence_id, user_id, channel_id, channel_kind, scheduled_at, fired_at, snoozed, status, attempts, last_error, next_attempt_at, delivered_at, created_at, updated_at"
+
+func scanDelivery(row rowScanner) (models.Delivery, error) {
+	var delivery models.Delivery
+	err := row.Scan(&delivery.ID, &delivery.ReminderID, &delivery.OccurrenceID, &delivery.UserID, &delivery.ChannelID, &delivery.ChannelKind, &delivery.ScheduledAt, &delivery.FiredAt,
+		&delivery.Snoozed, &delivery.Status, &delivery.Attempts, &delivery.LastError, &delivery.NextAttemptAt, &delivery.DeliveredAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+	return delivery, err
+}
+
+func (s *service) queryDeliveries(query string, args ...any) ([]models.Delivery, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.Delivery = []models.Delivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// enqueueDelivery queues a job to attempt a delivery at runAt.
+func enqueueDelivery(tx *sql.Tx, deliveryId int, runAt time.Time) error {
+	_, err := tx.Exec("INSERT INTO jobs (kind, payload, run_at) VALUES ($1, jsonb_build_object('delivery_id', $2::int), $3)", models.JobDelivery, deliveryId, runAt)
+	return err
+}
+
+func (s *service) RecordDeliveryAttempt(delivery models.Delivery, attempt models.DeliveryAttempt) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO delivery_attempts (delivery_id, attempt, error, attempted_at) VALUES ($1, $2, $3, $4)",
+		delivery.ID, attempt.Attempt, attempt.Error, attempt.AttemptedAt)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE deliveries SET status = $2, attempts = $3, last_error = $4, next_attempt_at = $5, delivered_at = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		delivery.ID, delivery.Status, delivery.Attempts, delivery.LastError, delivery.NextAttemptAt, delivery.DeliveredAt)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) GetDeliveries(filter models.DeliveryFilter) ([]models.Delivery, error) {
+	query := "SELECT " + deliveryColumns + " FROM deliveries WHERE true"
+	var args []any
+
+	if filter.UserID != nil {
+		args = append(args, *filter.UserID)
+		query += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if filter.ReminderID != 0 {
+		args = append(args, filter.ReminderID)
+		query += fmt.Sprintf(" AND reminder_id = $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+
+	query += " ORDER BY id DESC"
+
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	return s.queryDeliveries(query, args...)
+}
+
+func (s *service) GetDelivery(id int) (models.Delivery, error) {
+	return scanDelivery(s.db.QueryRow("SELECT "+deliveryColumns+" FROM deliveries WHERE id = $1", id))
+}
+
+func (s *service) GetDeliveryAttempts(deliveryId int) ([]models.DeliveryAttempt, error) {
+	rows, err := s.db.Query("SELECT id, delivery_id, attempt, error, attempted_at FROM delivery_attempts WHERE delivery_id = $1 ORDER BY id", deliveryId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.DeliveryAttempt = []models.DeliveryAttempt{}
+	for rows.Next() {
+		var attempt models.DeliveryAttempt
+		if err := rows.Scan(&attempt.ID, &attempt.DeliveryID, &attempt.Attempt, &attempt.Error, &attempt.AttemptedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+func (s *service) RedriveDelivery(id int, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE deliveries SET status = 'pending', attempts = 0, last_error = '', next_attempt_at = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'failed'`, id, now)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := enqueueDelivery(tx, id, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const jobColumns = "id, kind, payload, run_at, attempts, locked_by, locked_until, last_error, created_at"
+
+func (s *service) ClaimJob(worker string, now, lockedUntil time.Time) (models.Job, error) {
+	var job models.Job
+	err := s.db.QueryRow(`UPDATE jobs SET locked_by = $1, locked_until = $3, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE run_at <= $2 AND (locked_until IS NULL OR locked_until <= $2)
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns, worker, now, lockedUntil).Scan(&job.ID, &job.Kind, &job.Payload, &job.RunAt, &job.Attempts, &job.LockedBy, &job.LockedUntil, &job.LastError, &job.CreatedAt)
+	return job, err
+}
+
+func (s *service) CompleteJob(id int, worker string) error {
+	return s.execJob("DELETE FROM jobs WHERE id = $1 AND locked_by = $2", id, worker)
+}
+
+func (s *service) RetryJob(id int, worker string, runAt time.Time, lastError string) error {
+	return s.execJob(`UPDATE jobs SET run_at = $3, last_error = $4, locked_by = NULL, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND locked_by = $2`, id, worker, runAt, lastError)
+}
+
+// execJob runs a statement on a job held by a worker and returns
+// sql.ErrNoRows if the worker no longer holds it.
+func (s *service) execJob(query string, args ...any) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const sessionColumns = "id, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at"
+
+func scanSession(row rowScanner) (models.Session, error) {
+	var session models.Session
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+	return session, err
+}
+
+func (s *service) CreateSession(session *models.Session, refreshTokenHash string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("INSERT INTO sessions (user_id, user_agent, ip, expires_at) VALUES ($1, $2, $3, $4) RETURNING id, created_at, last_seen_at",
+		session.UserID, session.UserAgent, session.IP, session.ExpiresAt).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO refresh_tokens (session_id, token_hash) VALUES ($1, $2)", session.ID, refreshTokenHash)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) GetSession(id int) (models.Session, error) {
+	return scanSession(s.db.QueryRow("SELECT "+sessionColumns+" FROM sessions WHERE id = $1", id))
+}
+
+func (s *service) RotateRefreshToken(tokenHash, newTokenHash string, now, expiresAt time.Time) (models.Session, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Session{}, err
+	}
+	defer tx.Rollback()
+
+	// Locking the session serialises concurrent rotations of its tokens.
+	var session models.Session
+	var tokenId int
+	var usedAt *time.Time
+
+	err = tx.QueryRow(`SELECT t.id, t.used_at, s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_seen_at, s.expires_at, s.revoked_at
+		FROM refresh_tokens t JOIN sessions s ON s.id = t.session_id
+		WHERE t.token_hash = $1 FOR UPDATE OF s`, tokenHash).Scan(&tokenId, &usedAt,
+		&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt)
+	if err != nil {
+		return session, err
+	}
+
+	if !session.Active(now) {
+		return session, sql.ErrNoRows
+	}
+
+	// Only the latest token of a session is ever unused, so a used one
+	// means someone else holds the session too.
+	if usedAt != nil {
+		if _, err := tx.Exec("UPDATE sessions SET revoked_at = $2 WHERE id = $1", session.ID, now); err != nil {
+			return session, err
+		}
+		if err := tx.Commit(); err != nil {
+			return session, err
+		}
+		return session, ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = $2 WHERE id = $1", tokenId, now); err != nil {
+		return session, err
+	}
+
+	if _, err := tx.Exec("INSERT INTO refresh_tokens (session_id, token_hash) VALUES ($1, $2)", session.ID, newTokenHash); err != nil {
+		return session, err
+	}
+
+	if _, err := tx.Exec("UPDATE sessions SET last_seen_at = $2, expires_at = $3 WHERE id = $1", session.ID, now, expiresAt); err != nil {
+		return session, err
+	}
+
+	session.LastSeenAt = now
+	session.ExpiresAt = expiresAt
+
+	return session, tx.Commit()
+}
+
+func (s *service) RevokeSession(id int, now time.Time) error {
+	return s.revokeSessions("UPDATE sessions SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL", id, now)
+}
+
+func (s *service) RevokeRefreshTokenSession(tokenHash string, now time.Time) error {
+	return s.revokeSessions(`UPDATE sessions SET revoked_at = $2
+		WHERE id = (SELECT session_id FROM refresh_tokens WHERE token_hash = $1) AND revoked_at IS NULL`, tokenHash, now)
+}
+
+func (s *service) GetActiveSessionsForUser(userId int, now time.Time) ([]models.Session, error) {
+	rows, err := s.db.Query("SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2 ORDER BY last_seen_at DESC, id DESC", userId, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session = []models.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *service) TouchSession(id int, ip string, now time.Time) error {
+	_, err := s.db.Exec("UPDATE sessions SET last_seen_at = $3, ip = $2 WHERE id = $1", id, ip, now)
+	return err
+}
+
+func (s *service) RevokeUserSession(id, userId int, now time.Time) error {
+	return s.revokeSessions("UPDATE sessions SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > $3", id, userId, now)
+}
+
+func (s *service) RevokeOtherSessions(userId, keepId int, now time.Time) (int, error) {
+	result, err := s.db.Exec("UPDATE sessions SET revoked_at = $3 WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL AND expires_at > $3", userId, keepId, now)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// revokeSessions runs a statement that revokes sessions and returns
+// sql.ErrNoRows if it revoked none.
+func (s *service) revokeSessions(query string, args ...any) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *service) SavePasswordResetToken(userId int, tokenHash string, expiresAt, now, since time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so concurrent requests cannot both pass the check
+	_, err = tx.Exec("SELECT id FROM users WHERE id = $1 FOR UPDATE", userId)
+	if err != nil {
+		return err
+	}
+
+	var recent bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM password_reset_tokens WHERE user_id = $1 AND created_at > $2)", userId, since).Scan(&recent)
+	if err != nil {
+		return err
+	}
+
+	if recent {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec("DELETE FROM password_reset_tokens WHERE user_id = $1 OR expires_at <= CURRENT_TIMESTAMP", userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO password_reset_tokens (token_hash, user_id, expires_at, created_at) VALUES ($1, $2, $3, $4)", tokenHash, userId, expiresAt, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) ResetPassword(tokenHash, passHash string, now time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userId int
+	err = tx.QueryRow("DELETE FROM password_reset_tokens WHERE token_hash = $1 AND expires_at > $2 RETURNING user_id", tokenHash, now).Scan(&userId)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE users SET pass = $2 WHERE id = $1", userId, passHash)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("DELETE FROM password_reset_tokens WHERE user_id = $1", userId)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("UPDATE sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL", userId, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, tx.Commit()
+}
+
+func (s *service) ClaimEmailVerification(userId int, now, since time.Time) error {
+	result, err := s.db.Exec(`UPDATE users SET email_verification_sent_at = $2
+		WHERE id = $1 AND email_verified_at IS NULL
+			AND (email_verification_sent_at IS NULL OR email_verification_sent_at <= $3)`, userId, now, since)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *service) VerifyEmail(userId int, email string, now time.Time) error {
+	result, err := s.db.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, $3) WHERE id = $1 AND email = $2", userId, email, now)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *service) SaveTOTPSecret(userId int, secret string) error {
+	return s.execMFA(`INSERT INTO totp_credentials (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = CURRENT_TIMESTAMP
+		WHERE totp_credentials.enabled_at IS NULL`, userId, secret)
+}
+
+func (s *service) GetTOTP(userId int) (models.TOTP, error) {
+	var totp models.TOTP
+	err := s.db.QueryRow("SELECT user_id, secret, enabled_at, last_counter, created_at FROM totp_credentials WHERE user_id = $1", userId).
+		Scan(&totp.UserID, &totp.Secret, &totp.EnabledAt, &totp.LastCounter, &totp.CreatedAt)
+	return totp, err
+}
+
+func (s *service) EnableTOTP(userId int, counter int64, recoveryCodeHashes []string, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE totp_credentials SET enabled_at = $3, last_counter = $2 WHERE user_id = $1 AND enabled_at IS NULL", userId, counter, now)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	for _, codeHash := range recoveryCodeHashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userId, codeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) DisableTOTP(userId int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM totp_credentials WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) UseTOTPCounter(userId int, counter int64) error {
+	return s.execMFA(`UPDATE totp_credentials SET last_counter = $2
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND (last_counter IS NULL OR last_counter < $2)`, userId, counter)
+}
+
+func (s *service) UseRecoveryCode(userId int, codeHash string, now time.Time) error {
+	return s.execMFA("UPDATE recovery_codes SET used_at = $3 WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL", userId, codeHash, now)
+}
+
+func (s *service) CreateMFAChallenge(userId int, tokenHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM mfa_challenges WHERE expires_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)", tokenHash, userId, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *service) AttemptMFAChallenge(tokenHash string, now time.Time, maxAttempts int) (int, error) {
+	var userId int
+	err := s.db.QueryRow(`UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1 AND expires_at > $2 AND attempts < $3
+		RETURNING user_id`, tokenHash, now, maxAttempts).Scan(&userId)
+	return userId, err
+}
+
+func (s *service) DeleteMFAChallenge(tokenHash string) error {
+	return s.execMFA("DELETE FROM mfa_challenges WHERE token_hash = $1", tokenHash)
+}
+
+// execMFA runs a statement on the second factors of a user and returns
+// sql.ErrNoRows if it affected none.
+func (s *service) execMFA(query string, args ...any) error {
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
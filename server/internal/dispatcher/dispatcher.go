@@ -0,0 +1,394 @@
+package dispatcher
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"server/internal/models"
+	"server/internal/notify"
+	"server/internal/queue"
+)
+
+// Store is the subset of database.Service the dispatcher needs.
+type Store interface {
+	GetUserById(id int) (models.User, error)
+	GetDueReminders(now time.Time) ([]models.Reminder, error)
+	FireOccurrence(occurrence *models.Occurrence, deliveries []models.Delivery, next *time.Time) error
+	GetChannelsForUser(userId int) ([]models.Channel, error)
+	GetChannel(id, userId int) (models.Channel, error)
+	GetReminderById(id int) (models.Reminder, error)
+	GetDelivery(id int) (models.Delivery, error)
+	RecordDeliveryAttempt(delivery models.Delivery, attempt models.DeliveryAttempt) error
+	SetReminderNextFire(id int, next *time.Time) error
+	UpdateReminderStatus(id int, status string) error
+}
+
+// Summary reports what a single dispatch run did.
+type Summary struct {
+	Scanned int `json:"scanned"`
+	Fired   int `json:"fired"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+type Dispatcher struct {
+	// mu serialises runs so the webhook and the scheduler never dispatch
+	// the same reminders concurrently within one process. Across
+	// processes, claiming occurrences keeps them from firing twice.
+	mu sync.Mutex
+
+	store    Store
+	notifier notify.Notifier
+	retry    RetryPolicy
+	now      func() time.Time
+
+	// requireVerifiedEmail fails the deliveries of users who have not
+	// verified their email address
+	requireVerifiedEmail bool
+}
+
+func New(store Store, notifier notify.Notifier, retry RetryPolicy) *Dispatcher {
+	return &Dispatcher{
+		store:    store,
+		notifier: notifier,
+		retry:    retry,
+		now:      time.Now,
+	}
+}
+
+// Dispatch fires every reminder whose next fire time has passed and
+// schedules its following occurrence. Firing queues a delivery job per
+// channel; the queue's workers send them. Cancelling ctx stops the run
+// between reminders.
+func (d *Dispatcher) Dispatch(ctx context.Context) (Summary, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var summary Summary
+
+	now := d.now()
+
+	reminders, err := d.store.GetDueReminders(now)
+	if err != nil {
+		return summary, err
+	}
+
+	for _, reminder := range reminders {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		summary.Scanned++
+
+		switch d.dispatchOne(reminder, now) {
+		case resultFired:
+			summary.Fired++
+		case resultFailed:
+			summary.Failed++
+		default:
+			summary.Skipped++
+		}
+	}
+
+	return summary, nil
+}
+
+type result int
+
+const (
+	resultSkipped result = iota
+	resultFired
+	resultFailed
+)
+
+func (d *Dispatcher) dispatchOne(reminder models.Reminder, now time.Time) result {
+	if reminder.Status != models.StatusPending {
+		return resultSkipped
+	}
+
+	if reminder.RecurrenceError != "" {
+		return resultSkipped
+	}
+
+	user, err := d.store.GetUserById(reminder.UserID)
+	if err != nil {
+		log.Printf("Error loading user %d for reminder %d: %v", reminder.UserID, reminder.ID, err)
+		return resultFailed
+	}
+
+	loc, err := LocationFor(user, reminder)
+	if err != nil {
+		log.Printf("Reminder %d has an invalid time zone: %v", reminder.ID, err)
+		return resultSkipped
+	}
+
+	schedule, err := ScheduleFor(reminder, loc)
+	if err != nil {
+		log.Printf("Reminder %d has an invalid schedule: %v", reminder.ID, err)
+		return resultSkipped
+	}
+
+	// A reminder without a next fire time has either never been scheduled
+	// or, once it has fired, no occurrences left.
+	scheduled, ok := reminder.NextFireAt, reminder.NextFireAt != nil
+	if !ok && reminder.LastFiredAt == nil {
+		var first time.Time
+		if first, ok = First(schedule, reminder.StartsAt); ok {
+			scheduled = &first
+		}
+	}
+
+	regularDue := ok && !scheduled.After(now)
+	snoozeDue := reminder.SnoozedUntil != nil && !reminder.SnoozedUntil.After(now)
+
+	switch {
+	case regularDue:
+	case snoozeDue:
+		return d.fireSnooze(reminder, now)
+	case !ok:
+		if reminder.SnoozedUntil == nil {
+			d.finish(reminder)
+		}
+		return resultSkipped
+	default:
+		// A reminder that has never been scheduled may not be due yet.
+		if reminder.NextFireAt == nil {
+			if err := d.store.SetReminderNextFire(reminder.ID, scheduled); err != nil {
+				log.Printf("Error scheduling reminder %d: %v", reminder.ID, err)
+				return resultFailed
+			}
+		}
+		return resultSkipped
+	}
+
+	// Missed occurrences are collapsed into this one, and so is a pending
+	// snooze of the previous occurrence.
+	var nextPtr *time.Time
+	if next, ok := schedule.Next(now); ok {
+		nextPtr = &next
+	}
+
+	return d.fire(reminder, models.Occurrence{ReminderID: reminder.ID, ScheduledAt: *scheduled, FiredAt: now}, nextPtr)
+}
+
+// fireSnooze delivers a snoozed occurrence again. The regular schedule is
+// left alone.
+func (d *Dispatcher) fireSnooze(reminder models.Reminder, now time.Time) result {
+	occurrence := models.Occurrence{ReminderID: reminder.ID, ScheduledAt: *reminder.SnoozedUntil, Snoozed: true, FiredAt: now}
+	return d.fire(reminder, occurrence, reminder.NextFireAt)
+}
+
+// fire claims an occurrence of reminder and queues its deliveries, then
+// completes the reminder if next is nil. An occurrence that another run
+// claimed first is skipped, so overlapping runs never notify twice.
+func (d *Dispatcher) fire(reminder models.Reminder, occurrence models.Occurrence, next *time.Time) result {
+	deliveries, err := d.deliveries(reminder, occurrence)
+	if err != nil {
+		log.Printf("Error routing reminder %d: %v", reminder.ID, err)
+		return resultFailed
+	}
+
+	err = d.store.FireOccurrence(&occurrence, deliveries, next)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Occurrence of reminder %d at %s was already fired", reminder.ID, occurrence.ScheduledAt.Format(time.RFC3339))
+		return resultSkipped
+	}
+	if err != nil {
+		log.Printf("Error firing reminder %d: %v", reminder.ID, err)
+		return resultFailed
+	}
+
+	if next == nil {
+		d.finish(reminder)
+	}
+
+	return resultFired
+}
+
+// deliveries creates a pending delivery of an occurrence of reminder for
+// each channel Route picks. Firing the occurrence queues a job for each,
+// so workers on any instance can send them.
+func (d *Dispatcher) deliveries(reminder models.Reminder, occurrence models.Occurrence) ([]models.Delivery, error) {
+	channels, err := d.store.GetChannelsForUser(reminder.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []models.Delivery
+	for _, channel := range Route(reminder, channels) {
+		channelId := channel.ID
+		nextAttemptAt := occurrence.FiredAt
+		deliveries = append(deliveries, models.Delivery{
+			ReminderID:    reminder.ID,
+			UserID:        reminder.UserID,
+			ChannelID:     &channelId,
+			ChannelKind:   channel.Kind,
+			ScheduledAt:   occurrence.ScheduledAt,
+			FiredAt:       occurrence.FiredAt,
+			Snoozed:       occurrence.Snoozed,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: &nextAttemptAt,
+		})
+	}
+
+	return deliveries, nil
+}
+
+// errPermanent marks delivery failures that retrying cannot fix.
+var errPermanent = errors.New("permanent failure")
+
+// HandleDelivery is the queue handler for JobDelivery jobs. It attempts
+// the delivery unless it is no longer pending and, while attempts remain,
+// asks the queue to run the job again when the next one is due.
+func (d *Dispatcher) HandleDelivery(ctx context.Context, job models.Job) error {
+	var payload models.DeliveryJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		log.Printf("Dropping job %d with invalid payload: %v", job.ID, err)
+		return nil
+	}
+
+	delivery, err := d.store.GetDelivery(payload.DeliveryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The reminder and its deliveries were deleted.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if delivery.Status != models.DeliveryPending {
+		return nil
+	}
+
+	// A worker that stopped after recording a failed attempt but before
+	// rescheduling the job leaves it due too early.
+	now := d.now()
+	if delivery.NextAttemptAt != nil && delivery.NextAttemptAt.After(now) {
+		return queue.RetryAt(*delivery.NextAttemptAt, errors.New(delivery.LastError))
+	}
+
+	delivery, err = d.deliver(ctx, delivery, now)
+	if err != nil {
+		return err
+	}
+
+	if delivery.Status == models.DeliveryPending {
+		return queue.RetryAt(*delivery.NextAttemptAt, errors.New(delivery.LastError))
+	}
+
+	return nil
+}
+
+// deliver attempts a delivery and records the outcome. A failed attempt
+// is retried with backoff until the retry policy runs out of attempts,
+// after which the delivery is dead-lettered as failed.
+func (d *Dispatcher) deliver(ctx context.Context, delivery models.Delivery, now time.Time) (models.Delivery, error) {
+	err := d.send(ctx, delivery)
+
+	delivery.Attempts++
+	attempt := models.DeliveryAttempt{
+		DeliveryID:  delivery.ID,
+		Attempt:     delivery.Attempts,
+		AttemptedAt: now,
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case errors.Is(err, errPermanent) || delivery.Attempts >= d.retry.MaxAttempts:
+		log.Printf("Delivery %d of reminder %d failed: %v", delivery.ID, delivery.ReminderID, err)
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		log.Printf("Delivery %d of reminder %d failed, retrying: %v", delivery.ID, delivery.ReminderID, err)
+		next := now.Add(d.retry.Delay(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+
+	if err != nil {
+		delivery.LastError = err.Error()
+		attempt.Error = err.Error()
+	}
+
+	if err := d.store.RecordDeliveryAttempt(delivery, attempt); err != nil {
+		return delivery, fmt.Errorf("recording delivery %d: %w", delivery.ID, err)
+	}
+
+	return delivery, nil
+}
+
+// send hands a delivery to the notifier. The reminder, user and channel
+// are loaded afresh so edits made since the occurrence fired are honoured.
+func (d *Dispatcher) send(ctx context.Context, delivery models.Delivery) error {
+	if delivery.ChannelID == nil {
+		return fmt.Errorf("channel was deleted: %w", errPermanent)
+	}
+
+	channel, err := d.store.GetChannel(*delivery.ChannelID, delivery.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("channel was deleted: %w", errPermanent)
+	}
+	if err != nil {
+		return err
+	}
+
+	reminder, err := d.store.GetReminderById(delivery.ReminderID)
+	if err != nil {
+		return err
+	}
+
+	user, err := d.store.GetUserById(delivery.UserID)
+	if err != nil {
+		return err
+	}
+
+	if d.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return fmt.Errorf("email address is not verified: %w", errPermanent)
+	}
+
+	// Only the account address is ever verified, so no other address can
+	// be sent email through the server
+	if channel.Kind == models.ChannelEmail && !notify.SameAddress(channel.Address, user.Email) {
+		return fmt.Errorf("email channel address is not verified: %w", errPermanent)
+	}
+
+	err = d.notifier.Notify(ctx, notify.Message{
+		User:        user,
+		Reminder:    reminder,
+		ScheduledAt: delivery.ScheduledAt,
+		FiredAt:     delivery.FiredAt,
+		Snoozed:     delivery.Snoozed,
+		Channel:     channel.Kind,
+		Address:     channel.Address,
+		Secret:      channel.Secret,
+	})
+
+	if errors.Is(err, notify.ErrNoRecipient) {
+		return fmt.Errorf("%w: %w", err, errPermanent)
+	}
+
+	return err
+}
+
+// RequireVerifiedEmail makes deliveries to users who have not verified
+// their email address fail without being sent. They can be re-driven once
+// the address is verified.
+func (d *Dispatcher) RequireVerifiedEmail(require bool) {
+	d.requireVerifiedEmail = require
+}
+
+// finish marks a reminder without further occurrences as completed.
+func (d *Dispatcher) finish(reminder models.Reminder) {
+	if err := d.store.UpdateReminderStatus(reminder.ID, models.StatusCompleted); err != nil {
+		log.Printf("Error completing reminder %d: %v", reminder.ID, err)
+	}
+}
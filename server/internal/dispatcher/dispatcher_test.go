@@ -0,0 +1,503 @@
+package dispatcher
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/notify"
+	"server/internal/recurrence"
+)
+
+type fakeStore struct {
+	reminders []models.Reminder
+	fired     map[int]*time.Time
+	scheduled map[int]*time.Time
+	statuses  map[int]string
+	snoozed   map[int]time.Time
+	channels  []models.Channel
+
+	occurrences map[string]bool
+	deliveries  []models.Delivery
+	attempts    []models.DeliveryAttempt
+}
+
+func newFakeStore(reminders ...models.Reminder) *fakeStore {
+	return &fakeStore{
+		reminders: reminders,
+		fired:     map[int]*time.Time{},
+		scheduled: map[int]*time.Time{},
+		statuses:  map[int]string{},
+		snoozed:   map[int]time.Time{},
+		channels:  []models.Channel{{ID: 1, Kind: models.ChannelEmail, Address: "user@example.com", Enabled: true}},
+
+		occurrences: map[string]bool{},
+	}
+}
+
+func (f *fakeStore) GetUserById(id int) (models.User, error) {
+	return models.User{ID: id, Email: "user@example.com"}, nil
+}
+
+func (f *fakeStore) GetDueReminders(now time.Time) ([]models.Reminder, error) {
+	return f.reminders, nil
+}
+
+func (f *fakeStore) FireOccurrence(occurrence *models.Occurrence, deliveries []models.Delivery, next *time.Time) error {
+	key := fmt.Sprintf("%d@%s", occurrence.ReminderID, occurrence.ScheduledAt)
+	if f.occurrences[key] {
+		return sql.ErrNoRows
+	}
+	f.occurrences[key] = true
+
+	for _, delivery := range deliveries {
+		delivery.ID = len(f.deliveries) + 1
+		f.deliveries = append(f.deliveries, delivery)
+	}
+
+	if occurrence.Snoozed {
+		f.snoozed[occurrence.ReminderID] = occurrence.FiredAt
+	} else {
+		f.fired[occurrence.ReminderID] = next
+	}
+
+	// Like the database, firing ends the snooze
+	for i := range f.reminders {
+		if f.reminders[i].ID == occurrence.ReminderID {
+			f.reminders[i].SnoozedUntil = nil
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) SetReminderNextFire(id int, next *time.Time) error {
+	f.scheduled[id] = next
+	return nil
+}
+
+func (f *fakeStore) GetChannelsForUser(userId int) ([]models.Channel, error) {
+	return f.channels, nil
+}
+
+func (f *fakeStore) GetChannel(id, userId int) (models.Channel, error) {
+	for _, channel := range f.channels {
+		if channel.ID == id {
+			return channel, nil
+		}
+	}
+	return models.Channel{}, sql.ErrNoRows
+}
+
+func (f *fakeStore) GetReminderById(id int) (models.Reminder, error) {
+	for _, reminder := range f.reminders {
+		if reminder.ID == id {
+			return reminder, nil
+		}
+	}
+	return models.Reminder{ID: id}, nil
+}
+
+func (f *fakeStore) GetDelivery(id int) (models.Delivery, error) {
+	if id < 1 || id > len(f.deliveries) {
+		return models.Delivery{}, sql.ErrNoRows
+	}
+	return f.deliveries[id-1], nil
+}
+
+func (f *fakeStore) RecordDeliveryAttempt(delivery models.Delivery, attempt models.DeliveryAttempt) error {
+	f.deliveries[delivery.ID-1] = delivery
+	f.attempts = append(f.attempts, attempt)
+	return nil
+}
+
+func (f *fakeStore) UpdateReminderStatus(id int, status string) error {
+	f.statuses[id] = status
+	return nil
+}
+
+type fakeNotifier struct {
+	sent     []int
+	channels []string
+	// snoozed records Message.Snoozed of each sent message
+	snoozed []bool
+	err     error
+	// failing lists channels that fail even when err is nil
+	failing map[string]bool
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+	if msg.Channel == models.ChannelWebPush {
+		return notify.ErrNoRecipient
+	}
+	if f.failing[msg.Channel] {
+		return errors.New("channel down")
+	}
+	f.sent = append(f.sent, msg.Reminder.ID)
+	f.channels = append(f.channels, msg.Channel)
+	f.snoozed = append(f.snoozed, msg.Snoozed)
+	return nil
+}
+
+// runDeliveries runs the queued jobs of all pending deliveries that are
+// due, as the queue's workers would, and returns the errors they returned.
+func runDeliveries(t *testing.T, d *Dispatcher, store *fakeStore) []error {
+	t.Helper()
+
+	var errs []error
+	for _, delivery := range store.deliveries {
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(d.now()) {
+			continue
+		}
+
+		payload, _ := json.Marshal(models.DeliveryJob{DeliveryID: delivery.ID})
+		errs = append(errs, d.HandleDelivery(context.Background(), models.Job{Kind: models.JobDelivery, Payload: payload}))
+	}
+	return errs
+}
+
+func TestDispatch(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+
+	daily := &recurrence.Recurrence{Frequency: recurrence.Daily}
+	until := time.Date(2024, 10, 1, 23, 59, 0, 0, time.UTC)
+	dailyUntil := &recurrence.Recurrence{Frequency: recurrence.Daily, Until: &until}
+
+	store := newFakeStore(
+		models.Reminder{ID: 1, Status: "pending", StartsAt: due, ScheduleKind: models.ScheduleRecurrence, Recurrence: daily, NextFireAt: &due},
+		models.Reminder{ID: 2, Status: "completed", StartsAt: due, ScheduleKind: models.ScheduleRecurrence, Recurrence: daily, NextFireAt: &due},
+		models.Reminder{ID: 3, Status: "pending", StartsAt: now.Add(23 * time.Hour), Recurrence: daily},
+		models.Reminder{ID: 4, Status: "pending", StartsAt: due, ScheduleKind: models.ScheduleRecurrence, Recurrence: dailyUntil, NextFireAt: &due},
+		models.Reminder{ID: 5, Status: "pending", RecurrenceError: "unknown interval", NextFireAt: &due},
+	)
+	notifier := &fakeNotifier{}
+
+	d := New(store, notifier, DefaultRetryPolicy)
+	d.now = func() time.Time { return now }
+
+	summary, err := d.Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	expected := Summary{Scanned: 5, Fired: 2, Skipped: 3}
+	if summary != expected {
+		t.Errorf("expected summary %+v; got %+v", expected, summary)
+	}
+
+	if len(notifier.sent) != 0 {
+		t.Errorf("expected Dispatch to queue deliveries rather than send them; sent %v", notifier.sent)
+	}
+
+	for _, err := range runDeliveries(t, d, store) {
+		if err != nil {
+			t.Errorf("HandleDelivery() returned error: %v", err)
+		}
+	}
+
+	if len(notifier.sent) != 2 || notifier.sent[0] != 1 || notifier.sent[1] != 4 {
+		t.Errorf("expected reminders 1 and 4 to be sent; got %v", notifier.sent)
+	}
+
+	if next := store.fired[1]; next == nil || !next.Equal(due.AddDate(0, 0, 1)) {
+		t.Errorf("expected reminder 1 to be rescheduled a day later; got %v", next)
+	}
+
+	if next := store.scheduled[3]; next == nil || !next.Equal(now.Add(23*time.Hour)) {
+		t.Errorf("expected reminder 3 to be scheduled for its first occurrence; got %v", next)
+	}
+
+	if next, ok := store.fired[4]; !ok || next != nil {
+		t.Errorf("expected reminder 4 to fire for the last time; got %v", next)
+	}
+
+	if store.statuses[4] != "completed" {
+		t.Errorf("expected reminder 4 to be completed; got %q", store.statuses[4])
+	}
+}
+
+func TestDispatchSendFailure(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+
+	store := newFakeStore(models.Reminder{ID: 1, Status: "pending", StartsAt: due, NextFireAt: &due})
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	d := New(store, &fakeNotifier{err: errors.New("boom")}, policy)
+	d.now = func() time.Time { return now }
+
+	summary, err := d.Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	expected := Summary{Scanned: 1, Fired: 1}
+	if summary != expected {
+		t.Errorf("expected summary %+v; got %+v", expected, summary)
+	}
+
+	errs := runDeliveries(t, d, store)
+
+	if _, ok := store.fired[1]; !ok {
+		t.Errorf("expected reminder to be recorded as fired despite the failed delivery")
+	}
+
+	if len(errs) != 1 || errs[0] == nil {
+		t.Fatalf("expected the delivery job to be retried; got %v", errs)
+	}
+
+	delivery := store.deliveries[0]
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.LastError != "boom" {
+		t.Fatalf("expected delivery to be retried after one attempt; got %+v", delivery)
+	}
+
+	if wait := delivery.NextAttemptAt.Sub(now); wait < 30*time.Second || wait > time.Minute {
+		t.Errorf("expected first retry within a minute; got %v", wait)
+	}
+
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Hour)
+		errs = runDeliveries(t, d, store)
+	}
+
+	if len(errs) != 1 || errs[0] != nil {
+		t.Errorf("expected the job of the dead-lettered delivery to complete; got %v", errs)
+	}
+
+	delivery = store.deliveries[0]
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != 3 || delivery.NextAttemptAt != nil {
+		t.Errorf("expected delivery to fail after three attempts; got %+v", delivery)
+	}
+
+	if len(store.attempts) != 3 {
+		t.Errorf("expected three recorded attempts; got %d", len(store.attempts))
+	}
+}
+
+func TestDispatchUnverifiedEmail(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+
+	store := newFakeStore(models.Reminder{ID: 1, Status: "pending", StartsAt: due, NextFireAt: &due})
+	notifier := &fakeNotifier{}
+
+	d := New(store, notifier, DefaultRetryPolicy)
+	d.RequireVerifiedEmail(true)
+	d.now = func() time.Time { return now }
+
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	if errs := runDeliveries(t, d, store); len(errs) != 1 || errs[0] != nil {
+		t.Fatalf("expected the delivery job to complete; got %v", errs)
+	}
+
+	delivery := store.deliveries[0]
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != 1 {
+		t.Errorf("expected the delivery to fail without retries; got %+v", delivery)
+	}
+
+	if len(notifier.sent) != 0 {
+		t.Errorf("expected nothing to be sent to an unverified user; got %v", notifier.sent)
+	}
+}
+
+func TestDispatchRestrictedEmailChannels(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+
+	store := newFakeStore(models.Reminder{ID: 1, Status: "pending", StartsAt: due, NextFireAt: &due})
+	store.channels = []models.Channel{
+		{ID: 1, Kind: models.ChannelEmail, Address: "User <USER@example.com>", Enabled: true},
+		{ID: 2, Kind: models.ChannelEmail, Address: "someone@example.com", Enabled: true},
+	}
+	notifier := &fakeNotifier{}
+
+	d := New(store, notifier, DefaultRetryPolicy)
+	d.now = func() time.Time { return now }
+
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	runDeliveries(t, d, store)
+
+	if store.deliveries[0].Status != models.DeliveryDelivered {
+		t.Errorf("expected the account address to be delivered to; got %+v", store.deliveries[0])
+	}
+
+	if store.deliveries[1].Status != models.DeliveryFailed {
+		t.Errorf("expected another address to fail; got %+v", store.deliveries[1])
+	}
+
+	if len(notifier.sent) != 1 {
+		t.Errorf("expected one email to be sent; got %v", notifier.sent)
+	}
+}
+
+func TestDispatchSnooze(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	fired := now.Add(-time.Hour)
+	snoozed := now.Add(-time.Minute)
+	later := now.Add(time.Hour)
+	next := now.AddDate(0, 0, 1)
+
+	daily := &recurrence.Recurrence{Frequency: recurrence.Daily}
+
+	store := newFakeStore(
+		models.Reminder{ID: 1, Status: "pending", StartsAt: fired, ScheduleKind: models.ScheduleRecurrence, Recurrence: daily, NextFireAt: &next, LastFiredAt: &fired, SnoozedUntil: &snoozed},
+		models.Reminder{ID: 2, Status: "pending", StartsAt: fired, ScheduleKind: models.ScheduleOnce, LastFiredAt: &fired, SnoozedUntil: &snoozed},
+		models.Reminder{ID: 3, Status: "pending", StartsAt: fired, ScheduleKind: models.ScheduleOnce, LastFiredAt: &fired, SnoozedUntil: &later},
+	)
+	notifier := &fakeNotifier{}
+
+	d := New(store, notifier, DefaultRetryPolicy)
+	d.now = func() time.Time { return now }
+
+	summary, err := d.Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	expected := Summary{Scanned: 3, Fired: 2, Skipped: 1}
+	if summary != expected {
+		t.Errorf("expected summary %+v; got %+v", expected, summary)
+	}
+
+	if _, ok := store.fired[1]; ok {
+		t.Errorf("expected snoozed reminder 1 to keep its schedule")
+	}
+
+	if _, ok := store.snoozed[1]; !ok {
+		t.Errorf("expected snoozed reminder 1 to fire")
+	}
+
+	if store.statuses[2] != "completed" {
+		t.Errorf("expected reminder 2 to be completed after its snooze; got %q", store.statuses[2])
+	}
+
+	if _, ok := store.statuses[3]; ok {
+		t.Errorf("expected reminder 3 to wait for its snooze")
+	}
+}
+
+func TestDispatchSnoozedMessage(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+
+	store := newFakeStore(
+		models.Reminder{ID: 1, Status: "pending", StartsAt: due.Add(-time.Hour), ScheduleKind: models.ScheduleOnce, LastFiredAt: &due, SnoozedUntil: &due},
+		models.Reminder{ID: 2, Status: "pending", StartsAt: due, ScheduleKind: models.ScheduleOnce, NextFireAt: &due},
+	)
+	notifier := &fakeNotifier{}
+
+	d := New(store, notifier, DefaultRetryPolicy)
+	d.now = func() time.Time { return now }
+
+	if _, err := d.Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	for _, err := range runDeliveries(t, d, store) {
+		if err != nil {
+			t.Fatalf("HandleDelivery() returned error: %v", err)
+		}
+	}
+
+	if len(notifier.sent) != 2 {
+		t.Fatalf("expected 2 messages; got %v", notifier.sent)
+	}
+
+	// The reminders are reloaded after firing cleared the snooze, so only
+	// the delivery knows where the occurrence came from
+	for i, id := range notifier.sent {
+		if notifier.snoozed[i] != (id == 1) {
+			t.Errorf("expected message for reminder %d to have Snoozed %t; got %t", id, id == 1, notifier.snoozed[i])
+		}
+	}
+}
+
+func TestDispatchChannels(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+
+	store := newFakeStore(models.Reminder{ID: 1, Status: "pending", StartsAt: due, ScheduleKind: models.ScheduleOnce, NextFireAt: &due})
+	store.channels = append(store.channels,
+		models.Channel{ID: 2, Kind: models.ChannelWebPush, Enabled: true},
+		models.Channel{ID: 3, Kind: models.ChannelWebhook, Address: "http://example.com/hook", Enabled: true},
+	)
+
+	notifier := &fakeNotifier{failing: map[string]bool{models.ChannelWebhook: true}}
+
+	d := New(store, notifier, DefaultRetryPolicy)
+	d.now = func() time.Time { return now }
+
+	summary, err := d.Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	if summary.Fired != 1 || len(store.deliveries) != 3 {
+		t.Fatalf("expected a delivery per channel; got %+v and %d deliveries", summary, len(store.deliveries))
+	}
+
+	runDeliveries(t, d, store)
+
+	// Web Push has no subscriptions, so retrying it is pointless.
+	statuses := []string{models.DeliveryDelivered, models.DeliveryFailed, models.DeliveryPending}
+	for i, delivery := range store.deliveries {
+		if delivery.Status != statuses[i] {
+			t.Errorf("expected %s delivery to be %s; got %s", delivery.ChannelKind, statuses[i], delivery.Status)
+		}
+	}
+
+	if len(notifier.channels) != 1 || notifier.channels[0] != models.ChannelEmail {
+		t.Errorf("expected delivery by email; got %v", notifier.channels)
+	}
+}
+
+func TestDispatchOverlappingRuns(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	due := now.Add(-time.Minute)
+	snoozed := now.Add(-time.Second)
+
+	daily := &recurrence.Recurrence{Frequency: recurrence.Daily}
+
+	store := newFakeStore(
+		models.Reminder{ID: 1, Status: "pending", StartsAt: due, ScheduleKind: models.ScheduleRecurrence, Recurrence: daily, NextFireAt: &due},
+		models.Reminder{ID: 2, Status: "pending", StartsAt: due, ScheduleKind: models.ScheduleOnce, LastFiredAt: &due, SnoozedUntil: &snoozed},
+	)
+
+	// Two instances dispatch the same due reminders, a second apart.
+	first := New(store, &fakeNotifier{}, DefaultRetryPolicy)
+	first.now = func() time.Time { return now }
+
+	second := New(store, &fakeNotifier{}, DefaultRetryPolicy)
+	second.now = func() time.Time { return now.Add(time.Second) }
+
+	if summary, err := first.Dispatch(context.Background()); err != nil || summary.Fired != 2 {
+		t.Fatalf("Dispatch() = %+v, %v; expected both reminders to fire", summary, err)
+	}
+
+	summary, err := second.Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch() returned error: %v", err)
+	}
+
+	if summary.Fired != 0 || summary.Skipped != 2 {
+		t.Errorf("expected the second run to skip occurrences already fired; got %+v", summary)
+	}
+
+	if len(store.deliveries) != 2 {
+		t.Errorf("expected one delivery per occurrence; got %d", len(store.deliveries))
+	}
+}
@@ -0,0 +1,84 @@
+package dispatcher
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides how often and when failed deliveries are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts after which a delivery is
+	// dead-lettered.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with
+	// every further retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy tries a delivery five times over roughly eight
+// minutes.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// Delay returns how long to wait after the given number of failed
+// attempts. Half of the exponential delay is random so deliveries that
+// failed together do not retry together.
+func (p RetryPolicy) Delay(failed int) time.Duration {
+	shift := max(failed-1, 0)
+
+	// Compare against MaxDelay shifted right, as shifting BaseDelay left
+	// can overflow
+	delay := p.MaxDelay
+	if shift < 62 && p.BaseDelay <= p.MaxDelay>>shift {
+		delay = p.BaseDelay << shift
+	}
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// RetryPolicyFromEnv reads DELIVERY_MAX_ATTEMPTS, DELIVERY_RETRY_BASE and
+// DELIVERY_RETRY_MAX, falling back to DefaultRetryPolicy.
+func RetryPolicyFromEnv() (RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+
+	if value := os.Getenv("DELIVERY_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return policy, fmt.Errorf("invalid DELIVERY_MAX_ATTEMPTS %q", value)
+		}
+		policy.MaxAttempts = attempts
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"DELIVERY_RETRY_BASE", &policy.BaseDelay},
+		{"DELIVERY_RETRY_MAX", &policy.MaxDelay},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+
+		delay, err := time.ParseDuration(value)
+		if err != nil || delay <= 0 {
+			return policy, fmt.Errorf("invalid %s %q", setting.name, value)
+		}
+		*setting.value = delay
+	}
+
+	if policy.MaxDelay < policy.BaseDelay {
+		return policy, fmt.Errorf("DELIVERY_RETRY_MAX must not be less than DELIVERY_RETRY_BASE")
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,43 @@
+package dispatcher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+
+	tests := []struct {
+		failed int
+		max    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{64, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			delay := policy.Delay(tt.failed)
+			if delay < tt.max/2 || delay > tt.max {
+				t.Fatalf("expected delay after %d failures within [%v, %v]; got %v", tt.failed, tt.max/2, tt.max, delay)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyDelayOverflow(t *testing.T) {
+	// A second shifted by 31 or more no longer fits a time.Duration
+	policy := RetryPolicy{MaxAttempts: 100, BaseDelay: time.Second, MaxDelay: time.Hour}
+
+	for _, failed := range []int{40, 64} {
+		delay := policy.Delay(failed)
+		if delay < policy.MaxDelay/2 || delay > policy.MaxDelay {
+			t.Errorf("expected delay after %d failures to be capped at %v; got %v", failed, policy.MaxDelay, delay)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package dispatcher
+
+import "server/internal/models"
+
+// Route picks the channels of its owner an occurrence of reminder is
+// delivered to: the channel of the reminder, else the default channel,
+// else every enabled channel. Disabled channels are skipped, so a reminder
+// whose channel was disabled falls back to the default.
+func Route(reminder models.Reminder, channels []models.Channel) []models.Channel {
+	var enabled []models.Channel
+	for _, channel := range channels {
+		if channel.Enabled {
+			enabled = append(enabled, channel)
+		}
+	}
+
+	if reminder.ChannelID != nil {
+		for _, channel := range enabled {
+			if channel.ID == *reminder.ChannelID {
+				return []models.Channel{channel}
+			}
+		}
+	}
+
+	for _, channel := range enabled {
+		if channel.IsDefault {
+			return []models.Channel{channel}
+		}
+	}
+
+	return enabled
+}
@@ -0,0 +1,49 @@
+package dispatcher
+
+import (
+	"testing"
+
+	"server/internal/models"
+)
+
+func TestRoute(t *testing.T) {
+	email := models.Channel{ID: 1, Kind: models.ChannelEmail, Enabled: true}
+	slack := models.Channel{ID: 2, Kind: models.ChannelSlack, Enabled: true}
+	disabled := models.Channel{ID: 3, Kind: models.ChannelWebhook}
+	defaultSlack := slack
+	defaultSlack.IsDefault = true
+
+	override := func(id int) *int { return &id }
+
+	tests := []struct {
+		name     string
+		channel  *int
+		channels []models.Channel
+		expected []int
+	}{
+		{"every enabled channel", nil, []models.Channel{email, slack, disabled}, []int{1, 2}},
+		{"default channel", nil, []models.Channel{email, defaultSlack}, []int{2}},
+		{"override", override(1), []models.Channel{email, defaultSlack}, []int{1}},
+		{"disabled override", override(3), []models.Channel{email, defaultSlack, disabled}, []int{2}},
+		{"deleted override", override(9), []models.Channel{email, slack}, []int{1, 2}},
+		{"no channels", nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			for _, channel := range Route(models.Reminder{ChannelID: tt.channel}, tt.channels) {
+				ids = append(ids, channel.ID)
+			}
+
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("expected channels %v; got %v", tt.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Fatalf("expected channels %v; got %v", tt.expected, ids)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package dispatcher
+
+import (
+	"fmt"
+	"time"
+
+	"server/internal/cron"
+	"server/internal/models"
+	"server/internal/recurrence"
+	"server/internal/tz"
+)
+
+// Schedule yields the occurrences of a reminder.
+type Schedule interface {
+	// Next returns the first occurrence strictly after after. It returns
+	// false once there are no further occurrences.
+	Next(after time.Time) (time.Time, bool)
+}
+
+// LocationFor returns the time zone a reminder is scheduled in: its own
+// override if it has one and otherwise the time zone of its user.
+func LocationFor(user models.User, reminder models.Reminder) (*time.Location, error) {
+	if reminder.TimeZone != "" {
+		return tz.Load(reminder.TimeZone)
+	}
+	return tz.Load(user.TimeZone)
+}
+
+// ScheduleFor returns the schedule of a reminder according to its kind,
+// with wall clock times interpreted in loc.
+func ScheduleFor(reminder models.Reminder, loc *time.Location) (Schedule, error) {
+	start := reminder.StartsAt.In(loc)
+
+	switch reminder.ScheduleKind {
+	case models.ScheduleOnce, "":
+		return onceSchedule{start}, nil
+	case models.ScheduleRecurrence:
+		if reminder.Recurrence == nil {
+			return nil, fmt.Errorf("reminder %d has no recurrence", reminder.ID)
+		}
+		return recurrenceSchedule{*reminder.Recurrence, start}, nil
+	case models.ScheduleCron:
+		s, err := cron.Parse(reminder.CronExpression)
+		if err != nil {
+			return nil, err
+		}
+		return cronSchedule{s, start}, nil
+	}
+	return nil, fmt.Errorf("unknown schedule kind %q", reminder.ScheduleKind)
+}
+
+// First returns the first occurrence of a schedule at or after start.
+func First(s Schedule, start time.Time) (time.Time, bool) {
+	return s.Next(start.Add(-time.Nanosecond))
+}
+
+type onceSchedule struct {
+	at time.Time
+}
+
+func (s onceSchedule) Next(after time.Time) (time.Time, bool) {
+	return s.at, s.at.After(after)
+}
+
+type recurrenceSchedule struct {
+	rule  recurrence.Recurrence
+	start time.Time
+}
+
+func (s recurrenceSchedule) Next(after time.Time) (time.Time, bool) {
+	return s.rule.Next(s.start, after)
+}
+
+type cronSchedule struct {
+	cron  *cron.Schedule
+	start time.Time
+}
+
+func (s cronSchedule) Next(after time.Time) (time.Time, bool) {
+	if after.Before(s.start) {
+		after = s.start.Add(-time.Nanosecond)
+	}
+
+	next := s.cron.Next(after.In(s.start.Location()))
+	return next, !next.IsZero()
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Notification channel kinds.
+const (
+	// ChannelEmail delivers to the email address in Address. Every user
+	// starts with one for the address they registered with.
+	ChannelEmail = "email"
+	// ChannelWebhook POSTs a signed JSON payload to Address.
+	ChannelWebhook = "webhook"
+	// ChannelSlack posts to a Slack incoming webhook URL.
+	ChannelSlack = "slack"
+	// ChannelDiscord posts to a Discord webhook URL.
+	ChannelDiscord = "discord"
+	// ChannelTelegram sends through the Telegram bot to the chat ID in
+	// Address. It is registered by linking a chat rather than directly.
+	ChannelTelegram = "telegram"
+	// ChannelNtfy publishes to the ntfy topic URL in Address, with Secret
+	// as an optional access token.
+	ChannelNtfy = "ntfy"
+	// ChannelGotify posts to the Gotify server in Address with Secret as
+	// the application token.
+	ChannelGotify = "gotify"
+	// ChannelWebPush pushes to every browser the user subscribed. It is
+	// created with the first subscription.
+	ChannelWebPush = "webpush"
+)
+
+// Channel is a destination a user registered for their reminders. Address
+// is where the channel delivers to, such as a URL. Secret is never
+// returned once it has been saved.
+//
+// Reminders go to their own channel if they have one, else to the default
+// channel of their user, else to every enabled channel. Disabled channels
+// are never delivered to.
+type Channel struct {
+	ID        int       `json:"id" xml:"id" form:"id"`
+	UserID    int       `json:"user_id" xml:"user_id" form:"user_id"`
+	Kind      string    `json:"kind" xml:"kind" form:"kind"`
+	Address   string    `json:"address" xml:"address" form:"address"`
+	Secret    string    `json:"-" xml:"-" form:"-"`
+	Enabled   bool      `json:"enabled" xml:"enabled" form:"enabled"`
+	IsDefault bool      `json:"is_default" xml:"is_default" form:"is_default"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at" form:"created_at"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Delivery statuses.
+const (
+	// DeliveryPending deliveries wait for their next attempt at
+	// NextAttemptAt.
+	DeliveryPending = "pending"
+	// DeliveryDelivered deliveries were accepted by their channel.
+	DeliveryDelivered = "delivered"
+	// DeliveryFailed deliveries ran out of attempts or failed for good.
+	// They stay dead-lettered until they are re-driven.
+	DeliveryFailed = "failed"
+)
+
+// ValidDeliveryStatus reports whether status is a known delivery status.
+func ValidDeliveryStatus(status string) bool {
+	switch status {
+	case DeliveryPending, DeliveryDelivered, DeliveryFailed:
+		return true
+	}
+	return false
+}
+
+// Delivery is an occurrence of a reminder sent over one channel.
+// ChannelID is nil once the channel has been deleted, OccurrenceID for
+// deliveries made before occurrences were recorded. ScheduledAt is when
+// the occurrence was due, which may be well before FiredAt. Snoozed marks
+// deliveries of an occurrence that fired after a snooze.
+type Delivery struct {
+	ID            int        `json:"id" xml:"id" form:"id"`
+	ReminderID    int        `json:"reminder_id" xml:"reminder_id" form:"reminder_id"`
+	OccurrenceID  *int       `json:"occurrence_id" xml:"occurrence_id" form:"occurrence_id"`
+	UserID        int        `json:"user_id" xml:"user_id" form:"user_id"`
+	ChannelID     *int       `json:"channel_id" xml:"channel_id" form:"channel_id"`
+	ChannelKind   string     `json:"channel_kind" xml:"channel_kind" form:"channel_kind"`
+	ScheduledAt   time.Time  `json:"scheduled_at" xml:"scheduled_at" form:"scheduled_at"`
+	FiredAt       time.Time  `json:"fired_at" xml:"fired_at" form:"fired_at"`
+	Snoozed       bool       `json:"snoozed" xml:"snoozed" form:"snoozed"`
+	Status        string     `json:"status" xml:"status" form:"status"`
+	Attempts      int        `json:"attempts" xml:"attempts" form:"attempts"`
+	LastError     string     `json:"last_error,omitempty" xml:"last_error,omitempty" form:"last_error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at" xml:"next_attempt_at" form:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at" xml:"delivered_at" form:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at" xml:"created_at" form:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" xml:"updated_at" form:"updated_at"`
+}
+
+// DeliveryAttempt records a single try to send a delivery. Error is empty
+// for attempts that succeeded.
+type DeliveryAttempt struct {
+	ID          int       `json:"id" xml:"id" form:"id"`
+	DeliveryID  int       `json:"delivery_id" xml:"delivery_id" form:"delivery_id"`
+	Attempt     int       `json:"attempt" xml:"attempt" form:"attempt"`
+	Error       string    `json:"error,omitempty" xml:"error,omitempty" form:"error"`
+	AttemptedAt time.Time `json:"attempted_at" xml:"attempted_at" form:"attempted_at"`
+}
+
+// DeliveryFilter selects deliveries. Zero fields match everything.
+type DeliveryFilter struct {
+	// UserID limits deliveries to those of one user when it is not nil.
+	UserID     *int
+	ReminderID int
+	Status     string
+	Limit      int
+}
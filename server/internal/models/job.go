@@ -0,0 +1,31 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job kinds.
+const (
+	// JobDelivery jobs attempt a delivery. Their payload is a DeliveryJob.
+	JobDelivery = "delivery"
+)
+
+// Job is a unit of background work. A worker that claims a job holds it
+// until LockedUntil; after that, another worker may claim it again.
+type Job struct {
+	ID          int             `json:"id" xml:"id" form:"id"`
+	Kind        string          `json:"kind" xml:"kind" form:"kind"`
+	Payload     json.RawMessage `json:"payload" xml:"payload" form:"payload"`
+	RunAt       time.Time       `json:"run_at" xml:"run_at" form:"run_at"`
+	Attempts    int             `json:"attempts" xml:"attempts" form:"attempts"`
+	LockedBy    string          `json:"locked_by,omitempty" xml:"locked_by,omitempty" form:"locked_by"`
+	LockedUntil *time.Time      `json:"locked_until" xml:"locked_until" form:"locked_until"`
+	LastError   string          `json:"last_error,omitempty" xml:"last_error,omitempty" form:"last_error"`
+	CreatedAt   time.Time       `json:"created_at" xml:"created_at" form:"created_at"`
+}
+
+// DeliveryJob is the payload of a JobDelivery job.
+type DeliveryJob struct {
+	DeliveryID int `json:"delivery_id"`
+}
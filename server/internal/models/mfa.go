@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// TOTP is the authenticator app of a user. It is pending, and not asked
+// for at login, until the user confirms it with a first code.
+type TOTP struct {
+	UserID    int        `json:"user_id" xml:"user_id" form:"user_id"`
+	Secret    string     `json:"-" xml:"-" form:"-"`
+	EnabledAt *time.Time `json:"enabled_at" xml:"enabled_at" form:"enabled_at"`
+	// LastCounter is the period of the last code accepted, so codes
+	// cannot be replayed.
+	LastCounter *int64    `json:"-" xml:"-" form:"-"`
+	CreatedAt   time.Time `json:"created_at" xml:"created_at" form:"created_at"`
+}
+
+// Enabled reports whether the user confirmed the authenticator.
+func (t TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
@@ -1,5 +1,17 @@
 package models
 
+import (
+	"time"
+
+	"server/internal/recurrence"
+)
+
+// User roles.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // Field names should start with an uppercase letter
 type User struct {
 	ID    int    `json:"id" xml:"id" form:"id"`
@@ -7,17 +19,71 @@ type User struct {
 	Pass  string `json:"pass" xml:"pass" form:"pass"`
 	Fname string `json:"fname" xml:"fname" form:"fname"`
 	Lname string `json:"lname" xml:"lname" form:"lname"`
+	// TimeZone is the IANA name of the zone reminders are scheduled in.
+	TimeZone string `json:"time_zone" xml:"time_zone" form:"time_zone"`
+	// Role is RoleUser or RoleAdmin. Admins are promoted by updating
+	// users.role directly.
+	Role string `json:"role" xml:"role" form:"role"`
+	// EmailVerifiedAt is when the user proved they own Email, or nil if
+	// they have not yet.
+	EmailVerifiedAt *time.Time `json:"email_verified_at" xml:"email_verified_at" form:"email_verified_at"`
 }
 
+// Schedule kinds of a reminder.
+const (
+	// ScheduleOnce reminders fire a single time at StartsAt.
+	ScheduleOnce = "once"
+	// ScheduleRecurrence reminders repeat according to Recurrence.
+	ScheduleRecurrence = "recurrence"
+	// ScheduleCron reminders repeat according to CronExpression.
+	ScheduleCron = "cron"
+)
+
+// Reminder is a notification that fires from StartsAt onwards according to
+// ScheduleKind, in TimeZone or else the time zone of its user.
+// RecurrenceError is set when a legacy reminder_interval could not be
+// migrated; such reminders are not dispatched until they are fixed.
+// ChannelID, if set, is the only channel the reminder is delivered to.
 type Reminder struct {
-	ID               int    `json:"id" xml:"id" form:"id"`
-	UserID           int    `json:"user_id" xml:"user_id" form:"user_id"`
-	Name             string `json:"name" xml:"name" form:"name"`
-	Status           string `json:"status" xml:"status" form:"status"`
-	Description      string `json:"description" xml:"description" form:"description"`
-	Category         string `json:"category" xml:"category" form:"category"`
-	CreatedAt        string `json:"created_at" xml:"created_at" form:"created_at"`
-	UpdatedAt        string `json:"updated_at" xml:"updated_at" form:"updated_at"`
-	ReminderInterval string `json:"reminder_interval" xml:"reminder_interval" form:"reminder_interval"`
-	ReminderEnd      string `json:"reminder_end" xml:"reminder_end" form:"reminder_end"`
+	ID               int                    `json:"id" xml:"id" form:"id"`
+	UserID           int                    `json:"user_id" xml:"user_id" form:"user_id"`
+	Name             string                 `json:"name" xml:"name" form:"name"`
+	Status           string                 `json:"status" xml:"status" form:"status"`
+	Description      string                 `json:"description" xml:"description" form:"description"`
+	Category         string                 `json:"category" xml:"category" form:"category"`
+	CreatedAt        time.Time              `json:"created_at" xml:"created_at" form:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at" xml:"updated_at" form:"updated_at"`
+	ReminderInterval string                 `json:"reminder_interval" xml:"reminder_interval" form:"reminder_interval"`
+	ReminderEnd      string                 `json:"reminder_end" xml:"reminder_end" form:"reminder_end"`
+	StartsAt         time.Time              `json:"starts_at" xml:"starts_at" form:"starts_at"`
+	ScheduleKind     string                 `json:"schedule_kind" xml:"schedule_kind" form:"schedule_kind"`
+	TimeZone         string                 `json:"time_zone,omitempty" xml:"time_zone,omitempty" form:"time_zone"`
+	CronExpression   string                 `json:"cron_expression,omitempty" xml:"cron_expression,omitempty" form:"cron_expression"`
+	Recurrence       *recurrence.Recurrence `json:"recurrence" xml:"recurrence" form:"recurrence"`
+	RecurrenceError  string                 `json:"recurrence_error,omitempty" xml:"recurrence_error,omitempty" form:"recurrence_error"`
+	NextFireAt       *time.Time             `json:"next_fire_at" xml:"next_fire_at" form:"next_fire_at"`
+	LastFiredAt      *time.Time             `json:"last_fired_at" xml:"last_fired_at" form:"last_fired_at"`
+	FireCount        int                    `json:"fire_count" xml:"fire_count" form:"fire_count"`
+	SnoozedUntil     *time.Time             `json:"snoozed_until" xml:"snoozed_until" form:"snoozed_until"`
+	SnoozeCount      int                    `json:"snooze_count" xml:"snooze_count" form:"snooze_count"`
+	ChannelID        *int                   `json:"channel_id" xml:"channel_id" form:"channel_id"`
+}
+
+// Snooze records that a fired occurrence of a reminder was deferred.
+type Snooze struct {
+	ID           int        `json:"id" xml:"id" form:"id"`
+	ReminderID   int        `json:"reminder_id" xml:"reminder_id" form:"reminder_id"`
+	OccurrenceAt *time.Time `json:"occurrence_at" xml:"occurrence_at" form:"occurrence_at"`
+	SnoozedAt    time.Time  `json:"snoozed_at" xml:"snoozed_at" form:"snoozed_at"`
+	SnoozedUntil time.Time  `json:"snoozed_until" xml:"snoozed_until" form:"snoozed_until"`
+}
+
+// Occurrence records that a reminder fired for the time it was scheduled
+// at, or snoozed until if Snoozed. Each one is fired at most once.
+type Occurrence struct {
+	ID          int       `json:"id" xml:"id" form:"id"`
+	ReminderID  int       `json:"reminder_id" xml:"reminder_id" form:"reminder_id"`
+	ScheduledAt time.Time `json:"scheduled_at" xml:"scheduled_at" form:"scheduled_at"`
+	Snoozed     bool      `json:"snoozed" xml:"snoozed" form:"snoozed"`
+	FiredAt     time.Time `json:"fired_at" xml:"fired_at" form:"fired_at"`
 }
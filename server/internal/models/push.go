@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PushSubscription is a browser subscribed to Web Push notifications of a
+// user. P256dh and Auth are the base64url encoded keys from the browser.
+type PushSubscription struct {
+	ID        int       `json:"id" xml:"id" form:"id"`
+	UserID    int       `json:"user_id" xml:"user_id" form:"user_id"`
+	Endpoint  string    `json:"endpoint" xml:"endpoint" form:"endpoint"`
+	P256dh    string    `json:"-" xml:"-" form:"-"`
+	Auth      string    `json:"-" xml:"-" form:"-"`
+	UserAgent string    `json:"user_agent" xml:"user_agent" form:"user_agent"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at" form:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Session is a signed-in browser or device. Its refresh token is rotated
+// on every use, each rotation extending ExpiresAt, until the session
+// expires or is revoked.
+type Session struct {
+	ID         int        `json:"id" xml:"id" form:"id"`
+	UserID     int        `json:"user_id" xml:"user_id" form:"user_id"`
+	UserAgent  string     `json:"user_agent" xml:"user_agent" form:"user_agent"`
+	IP         string     `json:"ip" xml:"ip" form:"ip"`
+	CreatedAt  time.Time  `json:"created_at" xml:"created_at" form:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" xml:"last_seen_at" form:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" xml:"expires_at" form:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" xml:"revoked_at,omitempty" form:"revoked_at"`
+	// Current marks the session of the request that listed sessions.
+	Current bool `json:"current" xml:"current" form:"current"`
+}
+
+// Active reports whether the session may still be used at now.
+func (s Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
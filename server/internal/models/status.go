@@ -0,0 +1,36 @@
+package models
+
+// Reminder statuses. Only pending reminders are dispatched.
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+)
+
+// statusTransitions lists the statuses each status may move to.
+var statusTransitions = map[string][]string{
+	StatusPending:   {StatusCompleted, StatusCancelled},
+	StatusCompleted: {StatusPending},
+	StatusCancelled: {StatusPending},
+}
+
+// ValidStatus reports whether status is a known reminder status.
+func ValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether a reminder may move from one status to
+// another. Staying in the same status is always allowed.
+func CanTransition(from, to string) bool {
+	if from == to {
+		return ValidStatus(from)
+	}
+
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package models
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		allowed  bool
+	}{
+		{StatusPending, StatusCompleted, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusCompleted, StatusPending, true},
+		{StatusCancelled, StatusPending, true},
+		{StatusCompleted, StatusCancelled, false},
+		{StatusCancelled, StatusCompleted, false},
+		{StatusPending, StatusPending, true},
+		{StatusPending, "archived", false},
+		{"archived", "archived", false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.allowed {
+			t.Errorf("CanTransition(%q, %q) = %v; expected %v", tt.from, tt.to, got, tt.allowed)
+		}
+	}
+}
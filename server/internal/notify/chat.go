@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Length limits of Slack blocks and Discord embeds, in characters. Longer
+// text makes the whole message fail.
+const (
+	slackHeaderLength        = 150
+	slackSectionLength       = 3000
+	discordContentLength     = 2000
+	discordTitleLength       = 256
+	discordDescriptionLength = 4096
+	// categoryLength keeps category fields within the limits of both,
+	// even once Slack escapes every character.
+	categoryLength = 256
+)
+
+// Slack is a Notifier that posts to a Slack-compatible incoming webhook
+// URL given as the message address.
+type Slack struct {
+	client *http.Client
+}
+
+func NewSlack() *Slack {
+	return &Slack{client: newPublicClient(10 * time.Second)}
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+func (s *Slack) Notify(ctx context.Context, msg Message) error {
+	reminder := msg.Reminder
+
+	blocks := []slackBlock{{
+		Type: "header",
+		Text: &slackText{Type: "plain_text", Text: truncate(reminder.Name, slackHeaderLength)},
+	}}
+
+	if reminder.Description != "" {
+		blocks = append(blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "plain_text", Text: truncate(reminder.Description, slackSectionLength)},
+		})
+	}
+
+	// Slack renders the date in the time zone of whoever reads it
+	due := fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", msg.ScheduledAt.Unix(), msg.ScheduledAt.UTC().Format(time.RFC1123))
+
+	blocks = append(blocks, slackBlock{
+		Type: "section",
+		Fields: []slackText{
+			{Type: "mrkdwn", Text: "*Category*\n" + slackEscape(truncate(orNone(reminder.Category), categoryLength))},
+			{Type: "mrkdwn", Text: "*Due*\n" + due},
+		},
+	})
+
+	return postJSON(ctx, s.client, msg.Address, slackMessage{
+		Text: "Reminder: " + slackEscape(truncate(reminder.Name, slackSectionLength)),
+		Attachments: []slackAttachment{{
+			Color:  fmt.Sprintf("#%06x", CategoryColor(reminder.Category)),
+			Blocks: blocks,
+		}},
+	})
+}
+
+// slackEscape escapes the control characters of Slack mrkdwn so reminder
+// text cannot mention channels or users.
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+// Discord is a Notifier that posts to a Discord-compatible webhook URL
+// given as the message address.
+type Discord struct {
+	client *http.Client
+}
+
+func NewDiscord() *Discord {
+	return &Discord{client: newPublicClient(10 * time.Second)}
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       uint32         `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordMessage struct {
+	Content string         `json:"content"`
+	Embeds  []discordEmbed `json:"embeds"`
+	// AllowedMentions keeps reminder text from pinging anyone
+	AllowedMentions struct {
+		Parse []string `json:"parse"`
+	} `json:"allowed_mentions"`
+}
+
+func (d *Discord) Notify(ctx context.Context, msg Message) error {
+	reminder := msg.Reminder
+
+	message := discordMessage{
+		Content: truncate("Reminder: "+reminder.Name, discordContentLength),
+		Embeds: []discordEmbed{{
+			Title:       truncate(reminder.Name, discordTitleLength),
+			Description: truncate(reminder.Description, discordDescriptionLength),
+			Color:       CategoryColor(reminder.Category),
+			Fields: []discordField{
+				{Name: "Category", Value: truncate(orNone(reminder.Category), categoryLength), Inline: true},
+				// Discord renders the timestamp in the time zone of whoever
+				// reads it
+				{Name: "Due", Value: fmt.Sprintf("<t:%d:F>", msg.ScheduledAt.Unix()), Inline: true},
+			},
+			Timestamp: msg.ScheduledAt.UTC().Format(time.RFC3339),
+		}},
+	}
+	message.AllowedMentions.Parse = []string{}
+
+	return postJSON(ctx, d.client, msg.Address, message)
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "None"
+	}
+	return value
+}
+
+// truncate shortens text to at most max characters, ending it with an
+// ellipsis if anything was cut. It never splits a multi-byte character.
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	runes := []rune(text)
+	return string(runes[:max-1]) + "…"
+}
+
+// postJSON POSTs payload as JSON to url and fails on any non-2xx response.
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	return postJSONAuth(ctx, client, url, "", payload)
+}
+
+// postJSONAuth is postJSON with token, if set, sent as a bearer token.
+func postJSONAuth(ctx context.Context, client *http.Client, url, token string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return doRequest(client, req)
+}
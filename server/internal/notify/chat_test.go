@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"server/internal/models"
+)
+
+// chatStandIn records the JSON body of every request it receives.
+func chatStandIn(t *testing.T) (*httptest.Server, <-chan map[string]any) {
+	t.Helper()
+
+	bodies := make(chan map[string]any, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		data, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(data, &body); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+		bodies <- body
+	}))
+	t.Cleanup(server.Close)
+
+	return server, bodies
+}
+
+var chatMessage = Message{
+	Reminder:    models.Reminder{ID: 7, Name: "Stand-up <!channel>", Description: "Daily sync", Category: "Work"},
+	ScheduledAt: time.Date(2024, 10, 1, 9, 30, 0, 0, time.UTC),
+	FiredAt:     time.Date(2024, 10, 1, 9, 42, 0, 0, time.UTC),
+}
+
+func TestSlackNotify(t *testing.T) {
+	server, bodies := chatStandIn(t)
+
+	msg := chatMessage
+	msg.Address = server.URL
+	if err := NewSlack().Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	body := <-bodies
+
+	if text := body["text"].(string); strings.Contains(text, "<!channel>") {
+		t.Errorf("expected mentions to be escaped; got %q", text)
+	}
+
+	attachment := body["attachments"].([]any)[0].(map[string]any)
+	if attachment["color"] != "#2563eb" {
+		t.Errorf("expected the work colour; got %v", attachment["color"])
+	}
+
+	var encoded strings.Builder
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(attachment["blocks"])
+	for _, want := range []string{`"type":"header"`, "Daily sync", "*Category*\\nWork", "<!date^1727775000^"} {
+		if !strings.Contains(encoded.String(), want) {
+			t.Errorf("expected blocks to contain %q; got %s", want, encoded.String())
+		}
+	}
+}
+
+func TestDiscordNotify(t *testing.T) {
+	server, bodies := chatStandIn(t)
+
+	msg := chatMessage
+	msg.Address = server.URL
+	if err := NewDiscord().Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	body := <-bodies
+
+	embed := body["embeds"].([]any)[0].(map[string]any)
+	if embed["title"] != "Stand-up <!channel>" || embed["description"] != "Daily sync" {
+		t.Errorf("unexpected embed %v", embed)
+	}
+
+	if embed["color"] != float64(0x2563eb) {
+		t.Errorf("expected the work colour; got %v", embed["color"])
+	}
+
+	fields := embed["fields"].([]any)
+	if due := fields[1].(map[string]any)["value"]; due != "<t:1727775000:F>" {
+		t.Errorf("unexpected due field %v", due)
+	}
+
+	if mentions := body["allowed_mentions"].(map[string]any)["parse"]; len(mentions.([]any)) != 0 {
+		t.Errorf("expected mentions to be disabled; got %v", mentions)
+	}
+}
+
+func TestChatNotifyTruncates(t *testing.T) {
+	server, bodies := chatStandIn(t)
+
+	msg := chatMessage
+	msg.Address = server.URL
+	msg.Reminder.Name = strings.Repeat("é", 5000)
+	msg.Reminder.Description = strings.Repeat("日本", 3000)
+
+	if err := NewSlack().Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Slack Notify() returned error: %v", err)
+	}
+
+	blocks := (<-bodies)["attachments"].([]any)[0].(map[string]any)["blocks"].([]any)
+	header := blocks[0].(map[string]any)["text"].(map[string]any)["text"].(string)
+	section := blocks[1].(map[string]any)["text"].(map[string]any)["text"].(string)
+
+	if err := NewDiscord().Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Discord Notify() returned error: %v", err)
+	}
+
+	body := <-bodies
+	embed := body["embeds"].([]any)[0].(map[string]any)
+
+	tests := []struct {
+		name string
+		text string
+		max  int
+	}{
+		{"Slack header", header, 150},
+		{"Slack section", section, 3000},
+		{"Discord content", body["content"].(string), 2000},
+		{"Discord title", embed["title"].(string), 256},
+		{"Discord description", embed["description"].(string), 4096},
+	}
+
+	for _, tt := range tests {
+		if !utf8.ValidString(tt.text) {
+			t.Errorf("%s: expected valid UTF-8", tt.name)
+		}
+
+		if n := utf8.RuneCountInString(tt.text); n != tt.max || !strings.HasSuffix(tt.text, "…") {
+			t.Errorf("%s: expected %d characters ending with an ellipsis; got %d", tt.name, tt.max, n)
+		}
+	}
+}
+
+func TestCategoryColor(t *testing.T) {
+	if CategoryColor(" Work ") != CategoryColor("work") {
+		t.Errorf("expected categories to match regardless of case and spacing")
+	}
+
+	if CategoryColor("") != defaultColor {
+		t.Errorf("expected reminders without category to use the default colour")
+	}
+
+	if CategoryColor("gardening") != CategoryColor("Gardening") {
+		t.Errorf("expected unknown categories to get a stable colour")
+	}
+}
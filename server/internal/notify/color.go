@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"hash/fnv"
+	"strings"
+)
+
+// categoryColors maps common reminder categories to the colour chat
+// messages are accented with.
+var categoryColors = map[string]uint32{
+	"work":     0x2563eb,
+	"personal": 0x16a34a,
+	"health":   0xdc2626,
+	"finance":  0xca8a04,
+	"family":   0xdb2777,
+	"home":     0x9333ea,
+	"shopping": 0xea580c,
+	"study":    0x0891b2,
+}
+
+// palette colours categories missing from categoryColors.
+var palette = []uint32{0x0d9488, 0x7c3aed, 0x65a30d, 0xe11d48, 0x4f46e5, 0xd97706}
+
+// defaultColor accents reminders without a category.
+const defaultColor = 0x64748b
+
+// CategoryColor returns the RGB colour of a reminder category. Categories
+// are free text, so unknown ones get a colour derived from their name that
+// stays the same across messages.
+func CategoryColor(category string) uint32 {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return defaultColor
+	}
+
+	if color, ok := categoryColors[category]; ok {
+		return color
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(category))
+	return palette[h.Sum32()%uint32(len(palette))]
+}
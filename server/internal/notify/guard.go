@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for URLs that point at the server itself or
+// at its private network. Users choose the URLs notifiers post to, so they
+// must not be able to reach internal services through them.
+var ErrPrivateAddress = errors.New("address is not a public host")
+
+// allowPrivateAddresses turns the guard off so tests can post to servers
+// on loopback.
+var allowPrivateAddresses = false
+
+// publicIP reports whether ip may be contacted on behalf of a user.
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsUnspecified()
+}
+
+// CheckPublicHost resolves host and returns ErrPrivateAddress if any of its
+// addresses is loopback, private, link-local or unspecified.
+func CheckPublicHost(ctx context.Context, host string) error {
+	if allowPrivateAddresses {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %w", host, err)
+	}
+
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// dialPublic is a net.Dialer Control function that refuses connections to
+// addresses that are not public. It runs after DNS resolution, so a host
+// that resolved to a public address when it was saved cannot be rebound to
+// an internal one.
+func dialPublic(network, address string, c syscall.RawConn) error {
+	if allowPrivateAddresses {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("dial %s: %w", address, ErrPrivateAddress)
+	}
+	return nil
+}
+
+// newPublicClient returns an HTTP client for URLs chosen by users, which
+// only connects to public addresses. Proxies are not used, as the check
+// would then apply to the proxy rather than the destination.
+func newPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   dialPublic,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"server/internal/models"
+)
+
+func TestMain(m *testing.M) {
+	// The notifier tests post to servers on loopback
+	allowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestPublicClientRefusesPrivateAddresses(t *testing.T) {
+	allowPrivateAddresses = false
+	defer func() { allowPrivateAddresses = true }()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	err := NewWebhook().Notify(context.Background(), Message{
+		Reminder: models.Reminder{ID: 1},
+		FiredAt:  time.Now(),
+		Address:  srv.URL,
+		Secret:   "secret",
+	})
+
+	if !errors.Is(err, ErrPrivateAddress) || hits != 0 {
+		t.Errorf("expected the loopback server not to be contacted; got %v after %d requests", err, hits)
+	}
+
+	if err := CheckPublicHost(context.Background(), "127.0.0.1"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("expected loopback to be rejected; got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Package notify delivers fired reminders to the people they belong to.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"server/internal/models"
+)
+
+// Message is an occurrence of a reminder addressed to one recipient.
+type Message struct {
+	User     models.User
+	Reminder models.Reminder
+	// ScheduledAt is when the occurrence was due. It is earlier than
+	// FiredAt when the dispatcher was behind.
+	ScheduledAt time.Time
+	// FiredAt is when the occurrence fired.
+	FiredAt time.Time
+	// Snoozed is set when the occurrence fired after the reminder was
+	// snoozed. Firing clears Reminder.SnoozedUntil, so it cannot tell.
+	Snoozed bool
+	// Channel is the kind of channel the message is delivered over, one of
+	// the models.Channel constants.
+	Channel string
+	// Address identifies the recipient on the channel, such as an email
+	// address.
+	Address string
+	// Secret is the credential the channel was registered with, if any.
+	Secret string
+}
+
+// Notifier delivers messages over a single channel. Implementations must be
+// safe for concurrent use.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Email is a plain text email the app sends about an account, such as a
+// password reset link.
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer sends the app's own emails. Implementations must be safe for
+// concurrent use.
+type Mailer interface {
+	SendEmail(ctx context.Context, email Email) error
+}
+
+// Log is a Notifier and Mailer that only writes messages to the log. It is
+// used when no channel is configured.
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, msg Message) error {
+	log.Printf("Reminder %d (%s) fired for %s via %s", msg.Reminder.ID, msg.Reminder.Name, msg.Address, msg.Channel)
+	return nil
+}
+
+// SendEmail logs the whole email so links in it can be followed during
+// development.
+func (Log) SendEmail(ctx context.Context, email Email) error {
+	log.Printf("Email to %s: %s\n%s", email.To, email.Subject, email.Text)
+	return nil
+}
+
+// Router is a Notifier that hands each message to the Notifier registered
+// for its channel.
+type Router map[string]Notifier
+
+func (r Router) Notify(ctx context.Context, msg Message) error {
+	notifier, ok := r[msg.Channel]
+	if !ok {
+		return fmt.Errorf("unsupported channel %q", msg.Channel)
+	}
+	return notifier.Notify(ctx, msg)
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// AppURLFromEnv reads APP_URL, the address of the web app that push
+// notifications link to. It defaults to the local development server.
+func AppURLFromEnv() string {
+	if value := os.Getenv("APP_URL"); value != "" {
+		return strings.TrimSuffix(value, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// Push priorities on the ntfy scale.
+const (
+	PriorityDefault = 3
+	PriorityHigh    = 4
+)
+
+// urgentCategories are categories whose reminders are pushed with a high
+// priority.
+var urgentCategories = map[string]bool{
+	"urgent":    true,
+	"important": true,
+}
+
+// pushPriority rates a message from 1 (min) to 5 (max). A reminder is
+// pushed with a high priority when its category is urgent or when it fires
+// after a snooze.
+func pushPriority(msg Message) int {
+	if urgentCategories[strings.ToLower(strings.TrimSpace(msg.Reminder.Category))] || msg.Snoozed {
+		return PriorityHigh
+	}
+	return PriorityDefault
+}
+
+// pushText returns the title and message of a push notification.
+func pushText(msg Message) (title, message string) {
+	message = msg.Reminder.Description
+	if message == "" {
+		message = "Due " + localTime(msg).Format("Mon, 02 Jan 2006 15:04 MST")
+	}
+	return msg.Reminder.Name, message
+}
+
+// Ntfy is a Notifier that publishes to the ntfy topic URL given as the
+// message address, such as https://ntfy.sh/my-reminders. The message
+// secret, if any, is sent as a bearer token.
+type Ntfy struct {
+	appURL string
+	client *http.Client
+}
+
+func NewNtfy(appURL string) *Ntfy {
+	return &Ntfy{appURL: appURL, client: newPublicClient(10 * time.Second)}
+}
+
+func (n *Ntfy) Notify(ctx context.Context, msg Message) error {
+	server, topic, err := splitNtfyTopic(msg.Address)
+	if err != nil {
+		return err
+	}
+
+	title, message := pushText(msg)
+
+	payload := map[string]any{
+		"topic":    topic,
+		"title":    title,
+		"message":  message,
+		"priority": pushPriority(msg),
+		"click":    reminderURL(n.appURL, msg),
+	}
+
+	if msg.Reminder.Category != "" {
+		payload["tags"] = []string{msg.Reminder.Category}
+	}
+
+	return postJSONAuth(ctx, n.client, server, msg.Secret, payload)
+}
+
+// splitNtfyTopic splits a topic URL into the server it is published to and
+// the topic name.
+func splitNtfyTopic(address string) (server, topic string, err error) {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("invalid ntfy topic URL %q", address)
+	}
+
+	dir, topic := path.Split(strings.TrimSuffix(u.Path, "/"))
+	if topic == "" {
+		return "", "", errors.New("ntfy topic URL has no topic")
+	}
+
+	u.Path = dir
+	return u.String(), topic, nil
+}
+
+// Gotify is a Notifier that posts to the Gotify server given as the message
+// address, authenticated with the application token in the message secret.
+type Gotify struct {
+	appURL string
+	client *http.Client
+}
+
+func NewGotify(appURL string) *Gotify {
+	return &Gotify{appURL: appURL, client: newPublicClient(10 * time.Second)}
+}
+
+// gotifyPriorities maps ntfy priorities to the 0 to 10 scale of Gotify.
+var gotifyPriorities = map[int]int{1: 1, 2: 3, 3: 5, 4: 8, 5: 10}
+
+func (g *Gotify) Notify(ctx context.Context, msg Message) error {
+	title, message := pushText(msg)
+
+	payload := map[string]any{
+		"title":    title,
+		"message":  message,
+		"priority": gotifyPriorities[pushPriority(msg)],
+		"extras": map[string]any{
+			"client::notification": map[string]any{
+				"click": map[string]string{"url": reminderURL(g.appURL, msg)},
+			},
+		},
+	}
+
+	return postJSONAuth(ctx, g.client, strings.TrimSuffix(msg.Address, "/")+"/message", msg.Secret, payload)
+}
+
+// reminderURL links to the reminder of msg in the web app.
+func reminderURL(appURL string, msg Message) string {
+	return fmt.Sprintf("%s/dashboard?reminder=%d", appURL, msg.Reminder.ID)
+}
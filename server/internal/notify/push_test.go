@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"server/internal/models"
+)
+
+type pushRequest struct {
+	path          string
+	authorization string
+	body          map[string]any
+}
+
+// pushStandIn records every request it receives.
+func pushStandIn(t *testing.T) (*httptest.Server, <-chan pushRequest) {
+	t.Helper()
+
+	requests := make(chan pushRequest, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		requests <- pushRequest{r.URL.Path, r.Header.Get("Authorization"), body}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests
+}
+
+func TestNtfyNotify(t *testing.T) {
+	server, requests := pushStandIn(t)
+
+	err := NewNtfy("https://app.example.com").Notify(context.Background(), Message{
+		Reminder:    models.Reminder{ID: 7, Name: "Stretch", Category: "health"},
+		ScheduledAt: time.Date(2024, 10, 1, 9, 15, 0, 0, time.UTC),
+		FiredAt:     time.Date(2024, 10, 1, 9, 20, 0, 0, time.UTC),
+		Snoozed:     true,
+		Channel:     models.ChannelNtfy,
+		Address:     server.URL + "/alerts/reminders",
+		Secret:      "tk_123",
+	})
+	if err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	r := <-requests
+
+	if r.path != "/alerts/" || r.authorization != "Bearer tk_123" {
+		t.Errorf("unexpected request to %q with %q", r.path, r.authorization)
+	}
+
+	if r.body["topic"] != "reminders" || r.body["title"] != "Stretch" || r.body["message"] != "Due Tue, 01 Oct 2024 09:15 UTC" {
+		t.Errorf("unexpected payload %v", r.body)
+	}
+
+	if r.body["priority"] != float64(PriorityHigh) {
+		t.Errorf("expected a snoozed reminder to be pushed with high priority; got %v", r.body["priority"])
+	}
+
+	if r.body["click"] != "https://app.example.com/dashboard?reminder=7" {
+		t.Errorf("unexpected click URL %v", r.body["click"])
+	}
+}
+
+func TestGotifyNotify(t *testing.T) {
+	server, requests := pushStandIn(t)
+
+	err := NewGotify("https://app.example.com").Notify(context.Background(), Message{
+		Reminder: models.Reminder{ID: 7, Name: "Stretch", Description: "Five minutes"},
+		Channel:  models.ChannelGotify,
+		Address:  server.URL + "/",
+		Secret:   "app-token",
+	})
+	if err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	r := <-requests
+
+	if r.path != "/message" || r.authorization != "Bearer app-token" {
+		t.Errorf("unexpected request to %q with %q", r.path, r.authorization)
+	}
+
+	if r.body["message"] != "Five minutes" || r.body["priority"] != float64(5) {
+		t.Errorf("unexpected payload %v", r.body)
+	}
+}
@@ -0,0 +1,262 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPConfig describes the mail server email notifications are relayed
+// through.
+type SMTPConfig struct {
+	Host string
+	Port int
+	// Username and Password enable PLAIN authentication when Username is
+	// set.
+	Username string
+	Password string
+	// From is the sender address, optionally with a display name.
+	From string
+	// StartTLS requires the connection to be upgraded with STARTTLS before
+	// authenticating.
+	StartTLS bool
+	// TLSConfig overrides the TLS settings used for STARTTLS.
+	TLSConfig *tls.Config
+	// Timeout bounds a single delivery. It defaults to 30 seconds.
+	Timeout time.Duration
+}
+
+// SMTPConfigFromEnv reads the SMTP_HOST, SMTP_PORT, SMTP_USERNAME,
+// SMTP_PASSWORD, SMTP_FROM and SMTP_STARTTLS environment variables. ok is
+// false when SMTP_HOST is not set.
+func SMTPConfigFromEnv() (config SMTPConfig, ok bool, err error) {
+	config = SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		StartTLS: true,
+	}
+
+	if config.Host == "" {
+		return config, false, nil
+	}
+
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		if config.Port, err = strconv.Atoi(value); err != nil {
+			return config, false, fmt.Errorf("invalid SMTP_PORT %q", value)
+		}
+	}
+
+	if value := os.Getenv("SMTP_STARTTLS"); value != "" {
+		if config.StartTLS, err = strconv.ParseBool(value); err != nil {
+			return config, false, fmt.Errorf("invalid SMTP_STARTTLS %q", value)
+		}
+	}
+
+	return config, true, nil
+}
+
+// SMTP is a Notifier that emails the reminder to the message address. It
+// is also the Mailer for the app's own emails.
+type SMTP struct {
+	config SMTPConfig
+	from   *mail.Address
+}
+
+// SameAddress reports whether two email addresses, optionally with display
+// names, are the same mailbox. Domains are case-insensitive, and in
+// practice so are local parts.
+func SameAddress(a, b string) bool {
+	x, err := mail.ParseAddress(a)
+	if err != nil {
+		return false
+	}
+
+	y, err := mail.ParseAddress(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(x.Address, y.Address)
+}
+
+func NewSMTP(config SMTPConfig) (*SMTP, error) {
+	if config.Host == "" || config.Port == 0 {
+		return nil, errors.New("smtp host and port are required")
+	}
+
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from address %q: %w", config.From, err)
+	}
+
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return &SMTP{config: config, from: from}, nil
+}
+
+func (s *SMTP) Notify(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.Address)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", msg.Address, err)
+	}
+
+	body, err := s.render(msg, to)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, to, body)
+}
+
+func (s *SMTP) SendEmail(ctx context.Context, email Email) error {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", email.To, err)
+	}
+
+	body, err := s.compose(to, email.Subject, time.Now(), email.Text)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, to, body)
+}
+
+// send delivers a rendered email to a single recipient.
+func (s *SMTP) send(ctx context.Context, to *mail.Address, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.config.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+
+		tlsConfig := s.config.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: s.config.Host}
+		}
+
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if s.config.Username != "" {
+		auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return err
+	}
+
+	if err := client.Rcpt(to.Address); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// render builds the email for msg. Header values go through MIME encoding so
+// user-provided reminder names cannot inject headers.
+func (s *SMTP) render(msg Message, to *mail.Address) ([]byte, error) {
+	var text strings.Builder
+
+	text.WriteString(msg.Reminder.Name)
+	text.WriteString("\n")
+
+	if msg.Reminder.Description != "" {
+		text.WriteString("\n")
+		text.WriteString(msg.Reminder.Description)
+		text.WriteString("\n")
+	}
+
+	if msg.Reminder.Category != "" {
+		fmt.Fprintf(&text, "\nCategory: %s\n", msg.Reminder.Category)
+	}
+
+	fmt.Fprintf(&text, "\nDue %s\n", msg.ScheduledAt.Format(time.RFC1123Z))
+
+	return s.compose(to, "Reminder: "+msg.Reminder.Name, msg.FiredAt, text.String())
+}
+
+// compose builds a plain text email.
+func (s *SMTP) compose(to *mail.Address, subject string, date time.Time, text string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	headers := []struct{ name, value string }{
+		{"From", s.from.String()},
+		{"To", to.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	}
+
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header.name, header.value)
+	}
+
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/models"
+)
+
+// delivery is an email received by smtpStandIn.
+type delivery struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// smtpStandIn accepts a single SMTP session on a local port and reports the
+// delivered mail, so tests can assert on it without a real mail server.
+func smtpStandIn(t *testing.T) (port int, deliveries <-chan delivery) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	ch := make(chan delivery, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ESMTP stand-in")
+
+		var d delivery
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+
+			verb, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				_, encoded, _ := strings.Cut(arg, " ")
+				decoded, _ := base64.StdEncoding.DecodeString(encoded)
+				d.auth = string(decoded)
+				text.PrintfLine("235 Authenticated")
+			case "MAIL":
+				d.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				d.to = append(d.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 Go ahead")
+				data, err := text.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				d.data = string(data)
+				text.PrintfLine("250 Queued")
+			case "QUIT":
+				text.PrintfLine("221 Bye")
+				ch <- d
+				return
+			default:
+				text.PrintfLine("502 Unknown command")
+			}
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, ch
+}
+
+func TestSMTPNotify(t *testing.T) {
+	port, deliveries := smtpStandIn(t)
+
+	notifier, err := NewSMTP(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		Username: "alertify",
+		Password: "secret",
+		From:     "Alertify <alerts@example.com>",
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP() returned error: %v", err)
+	}
+
+	msg := Message{
+		User: models.User{ID: 1, Email: "user@example.com"},
+		Reminder: models.Reminder{
+			ID:          7,
+			Name:        "Pay rent\r\nBcc: victim@example.com",
+			Description: "Transfer to landlord – before noon",
+			Category:    "finance",
+		},
+		ScheduledAt: time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC),
+		FiredAt:     time.Date(2024, 10, 1, 9, 3, 0, 0, time.UTC),
+		Address:     "user@example.com",
+	}
+
+	if err := notifier.Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	var d delivery
+	select {
+	case d = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail delivered")
+	}
+
+	if d.auth != "\x00alertify\x00secret" {
+		t.Errorf("expected PLAIN credentials; got %q", d.auth)
+	}
+
+	if d.from != "alerts@example.com" || len(d.to) != 1 || d.to[0] != "user@example.com" {
+		t.Errorf("unexpected envelope from %q to %v", d.from, d.to)
+	}
+
+	parsed, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(d.data)))
+	if err != nil {
+		t.Fatalf("cannot parse delivered mail: %v", err)
+	}
+
+	if _, ok := parsed.Header["Bcc"]; ok {
+		t.Errorf("expected reminder name not to inject headers")
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Reminder: Pay rent\r\nBcc: victim@example.com" {
+		t.Errorf("unexpected subject %q (%v)", subject, err)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatalf("cannot decode body: %v", err)
+	}
+
+	if !strings.Contains(string(body), "Transfer to landlord – before noon") {
+		t.Errorf("expected description in body; got %q", body)
+	}
+
+	if !strings.Contains(string(body), "Category: finance") {
+		t.Errorf("expected category in body; got %q", body)
+	}
+
+	if !strings.Contains(string(body), "Due Tue, 01 Oct 2024 09:00:00 +0000") {
+		t.Errorf("expected the scheduled time in body; got %q", body)
+	}
+}
+
+func TestSMTPRequiresStartTLS(t *testing.T) {
+	port, _ := smtpStandIn(t)
+
+	notifier, err := NewSMTP(SMTPConfig{
+		Host:     "127.0.0.1",
+		Port:     port,
+		From:     "alerts@example.com",
+		StartTLS: true,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP() returned error: %v", err)
+	}
+
+	err = notifier.Notify(context.Background(), Message{Address: "user@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("expected STARTTLS to be required; got %v", err)
+	}
+}
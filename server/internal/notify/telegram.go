@@ -0,0 +1,177 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"server/internal/tz"
+)
+
+const (
+	// telegramTextLength is the most characters sendMessage accepts.
+	telegramTextLength = 4096
+	// telegramNameLength caps the escaped reminder name, which is sent
+	// as the bold first line.
+	telegramNameLength = 256
+)
+
+// TelegramConfig describes the bot reminders are sent from.
+type TelegramConfig struct {
+	Token string
+	// BaseURL is the Bot API server. It defaults to the public one.
+	BaseURL string
+	// Username is the bot username, used to build links that start a
+	// conversation with the bot.
+	Username string
+	// WebhookSecret is the secret token the bot webhook was set up with.
+	WebhookSecret string
+}
+
+// TelegramConfigFromEnv reads the TELEGRAM_BOT_TOKEN, TELEGRAM_API_URL,
+// TELEGRAM_BOT_USERNAME and TELEGRAM_WEBHOOK_SECRET environment variables.
+// ok is false when TELEGRAM_BOT_TOKEN is not set.
+func TelegramConfigFromEnv() (config TelegramConfig, ok bool) {
+	config = TelegramConfig{
+		Token:         os.Getenv("TELEGRAM_BOT_TOKEN"),
+		BaseURL:       os.Getenv("TELEGRAM_API_URL"),
+		Username:      os.Getenv("TELEGRAM_BOT_USERNAME"),
+		WebhookSecret: os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+	}
+	return config, config.Token != ""
+}
+
+// TelegramUpdate is the part of a Bot API update the server reacts to.
+type TelegramUpdate struct {
+	UpdateID int `json:"update_id"`
+	Message  *struct {
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// Telegram is a Notifier that sends reminders through a bot to the chat ID
+// given as the message address.
+type Telegram struct {
+	config TelegramConfig
+	client *http.Client
+}
+
+func NewTelegram(config TelegramConfig) *Telegram {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.telegram.org"
+	}
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return &Telegram{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Config returns the configuration of the bot.
+func (t *Telegram) Config() TelegramConfig {
+	return t.config
+}
+
+func (t *Telegram) Notify(ctx context.Context, msg Message) error {
+	reminder := msg.Reminder
+
+	head := fmt.Sprintf("<b>%s</b>\n", truncateEscaped(html.EscapeString(reminder.Name), telegramNameLength))
+
+	var tail string
+	if reminder.Category != "" {
+		tail = fmt.Sprintf("\nCategory: %s", truncateEscaped(html.EscapeString(reminder.Category), categoryLength))
+	}
+	tail += fmt.Sprintf("\nDue: %s", localTime(msg).Format("Mon, 02 Jan 2006 15:04 MST"))
+
+	// The description gets whatever room the other lines leave
+	var description string
+	if reminder.Description != "" {
+		room := telegramTextLength - utf8.RuneCountInString(head+tail) - 2
+		description = fmt.Sprintf("\n%s\n", truncateEscaped(html.EscapeString(reminder.Description), room))
+	}
+
+	return t.SendMessage(ctx, msg.Address, head+description+tail)
+}
+
+// truncateEscaped is truncate for HTML escaped text. It never cuts an
+// entity such as &amp; in half.
+func truncateEscaped(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	cut := string([]rune(text)[:max-1])
+	if i := strings.LastIndexByte(cut, '&'); i >= 0 && !strings.Contains(cut[i:], ";") {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// SendMessage sends an HTML formatted text to a chat.
+func (t *Telegram) SendMessage(ctx context.Context, chatID, text string) error {
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/bot%s/sendMessage", t.config.BaseURL, t.config.Token)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		// The error would contain the URL and with it the bot token
+		return errors.New("cannot reach the Telegram Bot API")
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("telegram responded with %s", resp.Status)
+	}
+
+	if !result.OK {
+		return fmt.Errorf("telegram responded with %s: %s", resp.Status, result.Description)
+	}
+
+	return nil
+}
+
+// localTime returns when msg was due in the time zone of its reminder or
+// else of its user, falling back to UTC.
+func localTime(msg Message) time.Time {
+	name := msg.Reminder.TimeZone
+	if name == "" {
+		name = msg.User.TimeZone
+	}
+
+	loc, err := tz.Load(name)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	return msg.ScheduledAt.In(loc)
+}
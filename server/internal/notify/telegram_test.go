@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"server/internal/models"
+)
+
+func TestTelegramNotify(t *testing.T) {
+	type request struct {
+		path string
+		body map[string]any
+	}
+	requests := make(chan request, 1)
+
+	botAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		requests <- request{r.URL.Path, body}
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer botAPI.Close()
+
+	telegram := NewTelegram(TelegramConfig{Token: "123:abc", BaseURL: botAPI.URL})
+
+	err := telegram.Notify(context.Background(), Message{
+		User:        models.User{TimeZone: "Europe/Berlin"},
+		Reminder:    models.Reminder{Name: "Call <mum>", Category: "family"},
+		ScheduledAt: time.Date(2024, 10, 1, 16, 0, 0, 0, time.UTC),
+		FiredAt:     time.Date(2024, 10, 1, 16, 5, 0, 0, time.UTC),
+		Channel:     models.ChannelTelegram,
+		Address:     "42",
+	})
+	if err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	r := <-requests
+
+	if r.path != "/bot123:abc/sendMessage" {
+		t.Errorf("unexpected path %q", r.path)
+	}
+
+	if r.body["chat_id"] != "42" || r.body["parse_mode"] != "HTML" {
+		t.Errorf("unexpected request %v", r.body)
+	}
+
+	text := r.body["text"].(string)
+	for _, want := range []string{"<b>Call &lt;mum&gt;</b>", "Category: family", "Due: Tue, 01 Oct 2024 18:00 CEST"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected text to contain %q; got %q", want, text)
+		}
+	}
+}
+
+func TestTelegramNotifyTruncates(t *testing.T) {
+	texts := make(chan string, 1)
+
+	botAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		texts <- body.Text
+		w.Write([]byte(`{"ok":true,"result":{}}`))
+	}))
+	defer botAPI.Close()
+
+	err := NewTelegram(TelegramConfig{Token: "123:abc", BaseURL: botAPI.URL}).Notify(context.Background(), Message{
+		Reminder:    models.Reminder{Name: strings.Repeat("<", 300), Description: strings.Repeat("a&b", 3000), Category: "chores"},
+		ScheduledAt: time.Date(2024, 10, 1, 16, 0, 0, 0, time.UTC),
+		Address:     "42",
+	})
+	if err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	text := <-texts
+
+	if n := utf8.RuneCountInString(text); n > telegramTextLength {
+		t.Errorf("expected at most %d characters; got %d", telegramTextLength, n)
+	}
+
+	if !strings.HasPrefix(text, "<b>") || strings.Count(text, "</b>") != 1 {
+		t.Errorf("expected the name to stay in one bold tag; got %q", text[:300])
+	}
+
+	for _, want := range []string{"…</b>", "…\n", "Category: chores", "Due: Tue, 01 Oct 2024 16:00 UTC"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected text to contain %q", want)
+		}
+	}
+
+	// Only whole entities are left once the tag is taken out
+	rest := strings.NewReplacer("<b>", "", "</b>", "", "&lt;", "", "&amp;", "").Replace(text)
+	if strings.ContainsAny(rest, "&<>") {
+		t.Errorf("expected no entity or tag to be cut; got %q", rest)
+	}
+}
+
+func TestTelegramNotifyRejected(t *testing.T) {
+	botAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"ok":false,"description":"Forbidden: bot was blocked by the user"}`))
+	}))
+	defer botAPI.Close()
+
+	err := NewTelegram(TelegramConfig{Token: "123:abc", BaseURL: botAPI.URL}).SendMessage(context.Background(), "42", "hi")
+	if err == nil || !strings.Contains(err.Error(), "blocked") {
+		t.Errorf("expected the Bot API error; got %v", err)
+	}
+}
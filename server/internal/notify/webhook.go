@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/models"
+)
+
+// Headers sent with every webhook delivery.
+const (
+	// WebhookIDHeader carries a unique ID per delivery that receivers can
+	// remember to drop replays within the tolerance window.
+	WebhookIDHeader = "X-Alertify-Id"
+	// WebhookTimestampHeader carries the Unix time the delivery was signed.
+	WebhookTimestampHeader = "X-Alertify-Timestamp"
+	// WebhookSignatureHeader carries "sha256=" followed by the hex encoded
+	// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the
+	// secret of the channel.
+	WebhookSignatureHeader = "X-Alertify-Signature"
+)
+
+// WebhookTolerance is how far the timestamp of a delivery may be from the
+// clock of the receiver before VerifyWebhook rejects it.
+const WebhookTolerance = 5 * time.Minute
+
+// WebhookEventFired is the event of a fired reminder.
+const WebhookEventFired = "reminder.fired"
+
+// WebhookPayload is the JSON body of a webhook delivery.
+type WebhookPayload struct {
+	Event      string          `json:"event"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Reminder   models.Reminder `json:"reminder"`
+}
+
+// Webhook is a Notifier that POSTs a signed WebhookPayload to the message
+// address.
+type Webhook struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewWebhook() *Webhook {
+	client := newPublicClient(10 * time.Second)
+	// A redirect is reported as a failed delivery instead of being
+	// replayed as a GET
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &Webhook{client: client, now: time.Now}
+}
+
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(WebhookPayload{
+		Event:      WebhookEventFired,
+		OccurredAt: msg.ScheduledAt,
+		Reminder:   msg.Reminder,
+	})
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(w.now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.Address, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Alertify-Webhook/1.0")
+	req.Header.Set(WebhookIDHeader, hex.EncodeToString(id))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+signWebhook(msg.Secret, timestamp, body))
+
+	return doRequest(w.client, req)
+}
+
+// VerifyWebhook checks that a delivery was signed with secret and is no
+// older than WebhookTolerance at now. Receivers should additionally drop
+// deliveries whose WebhookIDHeader they have already seen.
+func VerifyWebhook(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get(WebhookTimestampHeader)
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > WebhookTolerance || age < -WebhookTolerance {
+		return errors.New("timestamp outside of tolerance")
+	}
+
+	signature, ok := strings.CutPrefix(header.Get(WebhookSignatureHeader), "sha256=")
+	if !ok {
+		return errors.New("missing signature")
+	}
+
+	expected := signWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StatusError is returned for deliveries answered with a non-2xx status.
+type StatusError struct {
+	Host   string
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s responded with %s", e.Host, e.Status)
+}
+
+// doRequest sends req and treats any non-2xx response as a *StatusError.
+// The error ends up in the delivery log users can read, so the response
+// body is only logged on the server.
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		log.Printf("%s responded with %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(snippet))
+
+		return &StatusError{
+			Host:   req.URL.Host,
+			Code:   resp.StatusCode,
+			Status: resp.Status,
+		}
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
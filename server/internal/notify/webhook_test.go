@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/models"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header, body}
+	}))
+	defer receiver.Close()
+
+	webhook := NewWebhook()
+	webhook.now = func() time.Time { return now }
+
+	err := webhook.Notify(context.Background(), Message{
+		Reminder:    models.Reminder{ID: 7, Name: "Pay rent"},
+		ScheduledAt: now.Add(-time.Hour),
+		FiredAt:     now.Add(-time.Second),
+		Channel:     models.ChannelWebhook,
+		Address:     receiver.URL,
+		Secret:      "s3cret",
+	})
+	if err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	r := <-requests
+
+	if err := VerifyWebhook("s3cret", r.header, r.body, now); err != nil {
+		t.Errorf("expected delivery to verify; got %v", err)
+	}
+
+	if err := VerifyWebhook("other", r.header, r.body, now); err == nil {
+		t.Errorf("expected delivery not to verify with another secret")
+	}
+
+	tampered := append([]byte{}, r.body...)
+	tampered[len(tampered)-2] = ' '
+	if err := VerifyWebhook("s3cret", r.header, tampered, now); err == nil {
+		t.Errorf("expected tampered body not to verify")
+	}
+
+	if err := VerifyWebhook("s3cret", r.header, r.body, now.Add(WebhookTolerance+time.Second)); err == nil {
+		t.Errorf("expected replayed delivery to be rejected")
+	}
+
+	if r.header.Get(WebhookIDHeader) == "" {
+		t.Errorf("expected a delivery ID")
+	}
+
+	if ts := r.header.Get(WebhookTimestampHeader); ts != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("unexpected timestamp %q", ts)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(r.body, &payload); err != nil {
+		t.Fatalf("cannot decode payload: %v", err)
+	}
+
+	if payload.Event != WebhookEventFired || payload.Reminder.ID != 7 || !payload.OccurredAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestWebhookNotifyRejected(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+	}))
+	defer receiver.Close()
+
+	err := NewWebhook().Notify(context.Background(), Message{Address: receiver.URL})
+	if err == nil {
+		t.Fatal("expected a non-2xx response to fail the delivery")
+	}
+
+	// The error is shown to users, who must not read responses through it
+	if strings.Contains(err.Error(), "bad signature") {
+		t.Errorf("expected the response body to be left out of the error; got %q", err)
+	}
+}
@@ -0,0 +1,313 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+
+	"server/internal/models"
+)
+
+// ErrNoRecipient is returned by notifiers that had nobody to deliver a
+// message to, such as a user without push subscriptions.
+var ErrNoRecipient = errors.New("no recipient")
+
+// VAPIDKeys identify the server to push services. Both keys are unpadded
+// base64url encoded: the public key as an uncompressed P-256 point and the
+// private key as its 32 byte scalar.
+type VAPIDKeys struct {
+	Public  string
+	Private string
+}
+
+// GenerateVAPIDKeys creates a new VAPID key pair.
+func GenerateVAPIDKeys() (VAPIDKeys, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+
+	return VAPIDKeys{
+		Public:  base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		Private: base64.RawURLEncoding.EncodeToString(key.Bytes()),
+	}, nil
+}
+
+// PushSubscriptionStore is the subset of database.Service WebPush needs.
+type PushSubscriptionStore interface {
+	GetPushSubscriptionsForUser(userId int) ([]models.PushSubscription, error)
+	DeletePushSubscription(endpoint string) error
+}
+
+// WebPushPayload is the JSON the service worker of the web app receives.
+type WebPushPayload struct {
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+	URL        string `json:"url"`
+	Tag        string `json:"tag"`
+	ReminderID int    `json:"reminder_id"`
+}
+
+// WebPush is a Notifier that pushes to every browser subscription of the
+// message user. Subscriptions the push service reports as gone are
+// removed.
+type WebPush struct {
+	keys    VAPIDKeys
+	signer  *ecdsa.PrivateKey
+	subject string
+	appURL  string
+	store   PushSubscriptionStore
+	client  *http.Client
+	now     func() time.Time
+}
+
+// NewWebPush creates a WebPush notifier. subject is the mailto: or https:
+// contact push services can reach the operator at.
+func NewWebPush(keys VAPIDKeys, subject, appURL string, store PushSubscriptionStore) (*WebPush, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(keys.Private)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	private, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	public := private.PublicKey().Bytes()
+	if base64.RawURLEncoding.EncodeToString(public) != keys.Public {
+		return nil, errors.New("VAPID public key does not match the private key")
+	}
+
+	signer := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(public[1:33]),
+			Y:     new(big.Int).SetBytes(public[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+
+	return &WebPush{
+		keys:    keys,
+		signer:  signer,
+		subject: subject,
+		appURL:  appURL,
+		store:   store,
+		client:  newPublicClient(10 * time.Second),
+		now:     time.Now,
+	}, nil
+}
+
+// PublicKey returns the key browsers subscribe with.
+func (w *WebPush) PublicKey() string {
+	return w.keys.Public
+}
+
+func (w *WebPush) Notify(ctx context.Context, msg Message) error {
+	subscriptions, err := w.store.GetPushSubscriptionsForUser(msg.User.ID)
+	if err != nil {
+		return err
+	}
+
+	title, body := pushText(msg)
+
+	payload, err := json.Marshal(WebPushPayload{
+		Title:      title,
+		Body:       body,
+		URL:        reminderURL(w.appURL, msg),
+		Tag:        fmt.Sprintf("reminder-%d", msg.Reminder.ID),
+		ReminderID: msg.Reminder.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	urgency := "normal"
+	if pushPriority(msg) >= PriorityHigh {
+		urgency = "high"
+	}
+
+	delivered := 0
+	var errs []error
+	for _, subscription := range subscriptions {
+		err := w.push(ctx, subscription, payload, urgency)
+
+		var status *StatusError
+		if errors.As(err, &status) && (status.Code == http.StatusNotFound || status.Code == http.StatusGone) {
+			log.Printf("Removing expired push subscription %d of user %d", subscription.ID, subscription.UserID)
+			if err := w.store.DeletePushSubscription(subscription.Endpoint); err != nil {
+				log.Printf("Error removing push subscription %d: %v", subscription.ID, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		delivered++
+	}
+
+	if delivered > 0 {
+		return nil
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return ErrNoRecipient
+}
+
+// push encrypts payload for a subscription and sends it to its push
+// service.
+func (w *WebPush) push(ctx context.Context, subscription models.PushSubscription, payload []byte, urgency string) error {
+	uaPublic, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(subscription.P256dh, "="))
+	if err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(subscription.Auth, "="))
+	if err != nil {
+		return fmt.Errorf("invalid auth secret: %w", err)
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	body, err := encryptWebPush(payload, uaPublic, authSecret, asPrivate, salt)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(subscription.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": w.now().Add(12 * time.Hour).Unix(),
+		"sub": w.subject,
+	}).SignedString(w.signer)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, w.keys.Public))
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", "86400")
+	req.Header.Set("Urgency", urgency)
+
+	return doRequest(w.client, req)
+}
+
+// webPushRecordSize is the record size of encrypted payloads. Payloads are
+// sent as a single record, so it bounds their size.
+const webPushRecordSize = 4096
+
+// encryptWebPush encrypts plaintext for the user agent key uaPublic and
+// authSecret with the aes128gcm content coding, as described in RFC 8291.
+func encryptWebPush(plaintext, uaPublic, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	// A single record holds the plaintext, its delimiter and the tag
+	if len(plaintext)+1+16 > webPushRecordSize {
+		return nil, errors.New("push payload is too large")
+	}
+
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	ecdhSecret, err := asPrivate.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic...)
+	keyInfo = append(keyInfo, asPublic...)
+
+	ikm, err := expand(hkdf.Extract(sha256.New, ecdhSecret, authSecret), keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+
+	cek, err := expand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := expand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// 0x02 marks the last record
+	record := append(append([]byte{}, plaintext...), 0x02)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+func expand(prk, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,201 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+
+	"server/internal/models"
+)
+
+func b64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid base64url %q: %v", s, err)
+	}
+	return b
+}
+
+// TestEncryptWebPushVector checks the example from RFC 8291, Appendix A.
+func TestEncryptWebPushVector(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(b64(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := encryptWebPush(
+		[]byte("When I grow up, I want to be a watermelon"),
+		b64(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		b64(t, "BTBZMqHH6r4Tts7J_aSIgg"),
+		asPrivate,
+		b64(t, "DGv6ra1nlYgDCS1FRnbzlw"),
+	)
+	if err != nil {
+		t.Fatalf("encryptWebPush() returned error: %v", err)
+	}
+
+	expected := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := base64.RawURLEncoding.EncodeToString(body); got != expected {
+		t.Errorf("expected %s; got %s", expected, got)
+	}
+}
+
+// decryptWebPush decrypts a single record aes128gcm body the way a browser
+// does.
+func decryptWebPush(t *testing.T, body []byte, uaPrivate *ecdh.PrivateKey, authSecret []byte) []byte {
+	t.Helper()
+
+	salt, idLen := body[:16], int(body[20])
+	asPublic, ciphertext := body[21:21+idLen], body[21+idLen:]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatalf("invalid sender key: %v", err)
+	}
+
+	ecdhSecret, _ := uaPrivate.ECDH(asKey)
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPrivate.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asPublic...)
+
+	ikm, _ := expand(hkdf.Extract(sha256.New, ecdhSecret, authSecret), keyInfo, 32)
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := expand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce, _ := expand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("cannot decrypt push body: %v", err)
+	}
+
+	return bytes.TrimSuffix(plaintext, []byte{0x02})
+}
+
+type fakeSubscriptions struct {
+	subscriptions []models.PushSubscription
+	deleted       []string
+}
+
+func (f *fakeSubscriptions) GetPushSubscriptionsForUser(userId int) ([]models.PushSubscription, error) {
+	return f.subscriptions, nil
+}
+
+func (f *fakeSubscriptions) DeletePushSubscription(endpoint string) error {
+	f.deleted = append(f.deleted, endpoint)
+	return nil
+}
+
+func TestWebPushNotify(t *testing.T) {
+	uaPrivate, _ := ecdh.P256().GenerateKey(rand.Reader)
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("GenerateVAPIDKeys() returned error: %v", err)
+	}
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+
+	pushService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Header, body}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer pushService.Close()
+
+	store := &fakeSubscriptions{subscriptions: []models.PushSubscription{
+		{ID: 1, UserID: 1, Endpoint: pushService.URL + "/gone", P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4", Auth: "BTBZMqHH6r4Tts7J_aSIgg"},
+		{ID: 2, UserID: 1, Endpoint: pushService.URL + "/live", P256dh: base64.RawURLEncoding.EncodeToString(uaPrivate.PublicKey().Bytes()), Auth: base64.URLEncoding.EncodeToString(authSecret)},
+	}}
+
+	webPush, err := NewWebPush(keys, "mailto:ops@example.com", "https://app.example.com", store)
+	if err != nil {
+		t.Fatalf("NewWebPush() returned error: %v", err)
+	}
+
+	err = webPush.Notify(context.Background(), Message{
+		User:     models.User{ID: 1},
+		Reminder: models.Reminder{ID: 7, Name: "Water plants", Description: "Balcony too"},
+		Channel:  models.ChannelWebPush,
+	})
+	if err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+
+	if len(store.deleted) != 1 || !strings.HasSuffix(store.deleted[0], "/gone") {
+		t.Errorf("expected the gone subscription to be removed; got %v", store.deleted)
+	}
+
+	r := <-requests
+
+	if r.header.Get("Content-Encoding") != "aes128gcm" || r.header.Get("TTL") == "" {
+		t.Errorf("unexpected headers %v", r.header)
+	}
+
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(r.header.Get("Authorization"), "vapid "), ", ") {
+		if v, ok := strings.CutPrefix(part, "t="); ok {
+			token = v
+		}
+		if v, ok := strings.CutPrefix(part, "k="); ok {
+			key = v
+		}
+	}
+
+	if key != keys.Public {
+		t.Errorf("expected the VAPID public key; got %q", key)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return &webPush.signer.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"ES256"}), jwt.WithAudience(pushService.URL))
+	if err != nil {
+		t.Errorf("invalid VAPID token: %v", err)
+	}
+
+	var payload WebPushPayload
+	if err := json.Unmarshal(decryptWebPush(t, r.body, uaPrivate, authSecret), &payload); err != nil {
+		t.Fatalf("cannot decode payload: %v", err)
+	}
+
+	if payload.Title != "Water plants" || payload.Body != "Balcony too" || payload.URL != "https://app.example.com/dashboard?reminder=7" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestWebPushNoSubscriptions(t *testing.T) {
+	keys, _ := GenerateVAPIDKeys()
+	webPush, _ := NewWebPush(keys, "mailto:ops@example.com", "", &fakeSubscriptions{})
+
+	if err := webPush.Notify(context.Background(), Message{}); err != ErrNoRecipient {
+		t.Errorf("expected ErrNoRecipient; got %v", err)
+	}
+}
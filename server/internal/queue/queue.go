@@ -0,0 +1,253 @@
+// Package queue runs background jobs stored in Postgres. Any number of
+// pools, in any number of processes, can share one jobs table: workers
+// claim jobs with FOR UPDATE SKIP LOCKED and hold them under a lease, so a
+// job is only worked on by one worker at a time and the jobs of a worker
+// that crashed are picked up again once their lease expires.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"server/internal/models"
+	"server/internal/utils"
+)
+
+// Store is the subset of database.Service the pool needs.
+type Store interface {
+	ClaimJob(worker string, now, lockedUntil time.Time) (models.Job, error)
+	CompleteJob(id int, worker string) error
+	RetryJob(id int, worker string, runAt time.Time, lastError string) error
+}
+
+// Handler runs a job. Returning nil completes the job; returning an error
+// runs it again later, at the time given by RetryAt if the error is one.
+type Handler func(ctx context.Context, job models.Job) error
+
+// Config sizes a Pool.
+type Config struct {
+	// Workers is the number of jobs run concurrently.
+	Workers int
+	// Lease is how long a worker may hold a job before others may claim
+	// it. It should comfortably exceed the time a job takes.
+	Lease time.Duration
+	// PollInterval is how long an idle worker waits before looking for
+	// work again.
+	PollInterval time.Duration
+	// RetryDelay is how long a job that failed with a plain error waits
+	// before it runs again.
+	RetryDelay time.Duration
+}
+
+// DefaultConfig suits deliveries, which time out well within a minute.
+var DefaultConfig = Config{
+	Workers:      4,
+	Lease:        time.Minute,
+	PollInterval: time.Second,
+	RetryDelay:   time.Minute,
+}
+
+// ConfigFromEnv reads QUEUE_WORKERS, QUEUE_LEASE and QUEUE_POLL_INTERVAL,
+// falling back to DefaultConfig. Zero workers disables the pool.
+func ConfigFromEnv() (Config, error) {
+	config := DefaultConfig
+
+	if value := os.Getenv("QUEUE_WORKERS"); value != "" {
+		workers, err := strconv.Atoi(value)
+		if err != nil || workers < 0 {
+			return config, fmt.Errorf("invalid QUEUE_WORKERS %q", value)
+		}
+		config.Workers = workers
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"QUEUE_LEASE", &config.Lease},
+		{"QUEUE_POLL_INTERVAL", &config.PollInterval},
+	} {
+		value := os.Getenv(setting.name)
+		if value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return config, fmt.Errorf("invalid %s %q", setting.name, value)
+		}
+		*setting.value = d
+	}
+
+	return config, nil
+}
+
+// retryError asks for a job to run again at a given time.
+type retryError struct {
+	at  time.Time
+	err error
+}
+
+func (e *retryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryError) Unwrap() error {
+	return e.err
+}
+
+// RetryAt makes a Handler run its job again at t rather than after the
+// pool's RetryDelay. err is recorded as the job's last error.
+func RetryAt(t time.Time, err error) error {
+	return &retryError{at: t, err: err}
+}
+
+// Pool claims due jobs and runs them with the handler for their kind.
+type Pool struct {
+	store    Store
+	config   Config
+	handlers map[string]Handler
+	// id names this pool in the locked_by column of the jobs it holds.
+	id  string
+	now func() time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(store Store, config Config) *Pool {
+	host, _ := os.Hostname()
+	suffix, _ := utils.RandomToken(6)
+
+	return &Pool{
+		store:    store,
+		config:   config,
+		handlers: map[string]Handler{},
+		id:       fmt.Sprintf("%s:%d:%s", host, os.Getpid(), suffix),
+		now:      time.Now,
+	}
+}
+
+// Handle registers the handler for jobs of a kind. It must be called
+// before Start.
+func (p *Pool) Handle(kind string, handler Handler) {
+	p.handlers[kind] = handler
+}
+
+// Start launches the workers. It must be called at most once.
+func (p *Pool) Start() {
+	if p.config.Workers == 0 {
+		log.Println("QUEUE_WORKERS is 0, queued jobs are left to other instances")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for i := 0; i < p.config.Workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx, fmt.Sprintf("%s/%d", p.id, i))
+	}
+
+	log.Printf("Queue started with %d workers", p.config.Workers)
+}
+
+func (p *Pool) work(ctx context.Context, worker string) {
+	defer p.wg.Done()
+
+	for ctx.Err() == nil {
+		ran, err := p.RunOne(context.WithoutCancel(ctx), worker)
+		if err != nil {
+			log.Printf("Error claiming job: %v", err)
+		}
+		if ran {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.config.PollInterval):
+		}
+	}
+}
+
+// RunOne claims a single due job as worker and runs it. It reports
+// whether there was a job to run.
+func (p *Pool) RunOne(ctx context.Context, worker string) (bool, error) {
+	now := p.now()
+
+	job, err := p.store.ClaimJob(worker, now, now.Add(p.config.Lease))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Lease)
+	defer cancel()
+
+	err = p.run(ctx, job)
+
+	if err == nil {
+		err = p.store.CompleteJob(job.ID, worker)
+	} else {
+		runAt := p.now().Add(p.config.RetryDelay)
+
+		var retry *retryError
+		if errors.As(err, &retry) {
+			runAt = retry.at
+		} else {
+			log.Printf("Job %d (%s) failed: %v", job.ID, job.Kind, err)
+		}
+
+		err = p.store.RetryJob(job.ID, worker, runAt, err.Error())
+	}
+
+	// The lease ran out and another worker has the job now.
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Lost the lease on job %d (%s)", job.ID, job.Kind)
+		return true, nil
+	}
+
+	return true, err
+}
+
+func (p *Pool) run(ctx context.Context, job models.Job) error {
+	handler, ok := p.handlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for jobs of kind %q", job.Kind)
+	}
+
+	return handler(ctx, job)
+}
+
+// Stop prevents further claims and waits for running jobs to finish. It
+// returns ctx.Err() if ctx expires first.
+func (p *Pool) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Queue stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/models"
+)
+
+// fakeStore keeps jobs in memory with the same claiming rules as the
+// jobs table.
+type fakeStore struct {
+	mu   sync.Mutex
+	jobs map[int]*models.Job
+}
+
+func (f *fakeStore) ClaimJob(worker string, now, lockedUntil time.Time) (models.Job, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, job := range f.jobs {
+		if job.RunAt.After(now) || (job.LockedUntil != nil && job.LockedUntil.After(now)) {
+			continue
+		}
+		job.LockedBy = worker
+		job.LockedUntil = &lockedUntil
+		job.Attempts++
+		return *job, nil
+	}
+	return models.Job{}, sql.ErrNoRows
+}
+
+func (f *fakeStore) CompleteJob(id int, worker string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if job, ok := f.jobs[id]; !ok || job.LockedBy != worker {
+		return sql.ErrNoRows
+	}
+	delete(f.jobs, id)
+	return nil
+}
+
+func (f *fakeStore) RetryJob(id int, worker string, runAt time.Time, lastError string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	job, ok := f.jobs[id]
+	if !ok || job.LockedBy != worker {
+		return sql.ErrNoRows
+	}
+	job.RunAt = runAt
+	job.LastError = lastError
+	job.LockedBy = ""
+	job.LockedUntil = nil
+	return nil
+}
+
+func TestPoolRunOne(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(10 * time.Minute)
+
+	store := &fakeStore{jobs: map[int]*models.Job{
+		1: {ID: 1, Kind: "ok", RunAt: now},
+		2: {ID: 2, Kind: "retry", RunAt: now},
+		3: {ID: 3, Kind: "fail", RunAt: now},
+		4: {ID: 4, Kind: "unknown", RunAt: now},
+		5: {ID: 5, Kind: "ok", RunAt: later},
+	}}
+
+	pool := New(store, Config{Workers: 1, Lease: time.Minute, RetryDelay: 5 * time.Minute})
+	pool.now = func() time.Time { return now }
+	pool.Handle("ok", func(ctx context.Context, job models.Job) error { return nil })
+	pool.Handle("retry", func(ctx context.Context, job models.Job) error { return RetryAt(later, errors.New("not yet")) })
+	pool.Handle("fail", func(ctx context.Context, job models.Job) error { return errors.New("boom") })
+
+	for i := 0; i < 4; i++ {
+		ran, err := pool.RunOne(context.Background(), "worker")
+		if err != nil || !ran {
+			t.Fatalf("RunOne() = %v, %v; expected a job to run", ran, err)
+		}
+	}
+
+	if ran, err := pool.RunOne(context.Background(), "worker"); ran || err != nil {
+		t.Fatalf("RunOne() = %v, %v; expected no due jobs", ran, err)
+	}
+
+	if _, ok := store.jobs[1]; ok {
+		t.Errorf("expected completed job to be removed")
+	}
+
+	if job := store.jobs[2]; !job.RunAt.Equal(later) || job.LastError != "not yet" || job.LockedBy != "" {
+		t.Errorf("expected job 2 to be released until %v; got %+v", later, job)
+	}
+
+	if job := store.jobs[3]; !job.RunAt.Equal(now.Add(5*time.Minute)) || job.LastError != "boom" {
+		t.Errorf("expected job 3 to be retried after the retry delay; got %+v", job)
+	}
+
+	if job := store.jobs[4]; job.LastError == "" {
+		t.Errorf("expected job of unknown kind to record an error")
+	}
+}
+
+func TestPoolReclaimsExpiredLeases(t *testing.T) {
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	store := &fakeStore{jobs: map[int]*models.Job{
+		1: {ID: 1, Kind: "ok", RunAt: now},
+	}}
+
+	// A worker claimed the job and crashed.
+	if _, err := store.ClaimJob("crashed", now, now.Add(time.Minute)); err != nil {
+		t.Fatalf("ClaimJob() returned error: %v", err)
+	}
+
+	pool := New(store, Config{Workers: 1, Lease: time.Minute})
+	pool.now = func() time.Time { return now.Add(30 * time.Second) }
+	pool.Handle("ok", func(ctx context.Context, job models.Job) error { return nil })
+
+	if ran, _ := pool.RunOne(context.Background(), "worker"); ran {
+		t.Fatalf("expected the job to stay leased to the crashed worker")
+	}
+
+	pool.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	if ran, err := pool.RunOne(context.Background(), "worker"); !ran || err != nil {
+		t.Fatalf("RunOne() = %v, %v; expected the expired lease to be reclaimed", ran, err)
+	}
+
+	if len(store.jobs) != 0 {
+		t.Errorf("expected the reclaimed job to complete")
+	}
+
+	if err := store.CompleteJob(1, "crashed"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the crashed worker to have lost the job; got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseLegacy converts the free text reminder_interval and reminder_end
+// values used before recurrences were structured. It understands the
+// frequency names ("daily", "weekly", ...), counts such as "2d", "1w" or
+// "every 3 days", and whole hour or day durations such as "24h".
+func ParseLegacy(interval, end string) (Recurrence, error) {
+	r, err := parseLegacyInterval(strings.ToLower(strings.TrimSpace(interval)))
+	if err != nil {
+		return r, err
+	}
+
+	end = strings.TrimSpace(end)
+	if end != "" {
+		until, err := parseLegacyEnd(end)
+		if err != nil {
+			return r, err
+		}
+		r.Until = &until
+	}
+
+	return r, r.Validate()
+}
+
+func parseLegacyInterval(interval string) (Recurrence, error) {
+	switch interval {
+	case "hourly", "daily", "weekly", "monthly", "yearly":
+		return Recurrence{Frequency: Frequency(interval), Interval: 1}, nil
+	case "":
+		return Recurrence{}, fmt.Errorf("empty interval")
+	}
+
+	if rest, ok := strings.CutPrefix(interval, "every "); ok {
+		fields := strings.Fields(rest)
+		n := 1
+		if len(fields) == 2 {
+			var err error
+			if n, err = strconv.Atoi(fields[0]); err != nil || n <= 0 {
+				return Recurrence{}, fmt.Errorf("unknown interval %q", interval)
+			}
+			fields = fields[1:]
+		}
+		if len(fields) == 1 {
+			units := map[string]Frequency{
+				"hour": Hourly, "hours": Hourly,
+				"day": Daily, "days": Daily,
+				"week": Weekly, "weeks": Weekly,
+				"month": Monthly, "months": Monthly,
+				"year": Yearly, "years": Yearly,
+			}
+			if freq, ok := units[fields[0]]; ok {
+				return Recurrence{Frequency: freq, Interval: n}, nil
+			}
+		}
+		return Recurrence{}, fmt.Errorf("unknown interval %q", interval)
+	}
+
+	suffixes := map[string]Frequency{"d": Daily, "w": Weekly}
+	for suffix, freq := range suffixes {
+		if n, ok := strings.CutSuffix(interval, suffix); ok {
+			if count, err := strconv.Atoi(n); err == nil && count > 0 {
+				return Recurrence{Frequency: freq, Interval: count}, nil
+			}
+		}
+	}
+
+	d, err := time.ParseDuration(interval)
+	if err != nil || d <= 0 {
+		return Recurrence{}, fmt.Errorf("unknown interval %q", interval)
+	}
+
+	switch {
+	case d%(24*time.Hour) == 0:
+		return Recurrence{Frequency: Daily, Interval: int(d / (24 * time.Hour))}, nil
+	case d%time.Hour == 0:
+		return Recurrence{Frequency: Hourly, Interval: int(d / time.Hour)}, nil
+	}
+
+	return Recurrence{}, fmt.Errorf("interval %q is not a whole number of hours", interval)
+}
+
+func parseLegacyEnd(end string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, end); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, end)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown end %q", end)
+	}
+
+	// A date-only end includes the whole day.
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
@@ -0,0 +1,375 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/tz"
+)
+
+// Frequency is the unit a recurrence repeats in.
+type Frequency string
+
+const (
+	Hourly  Frequency = "hourly"
+	Daily   Frequency = "daily"
+	Weekly  Frequency = "weekly"
+	Monthly Frequency = "monthly"
+	Yearly  Frequency = "yearly"
+)
+
+// maxPeriods bounds how many periods Next will walk before giving up, so
+// rules that can never match (e.g. the 31st of every February) terminate.
+const maxPeriods = 100000
+
+// Recurrence describes when a reminder repeats. Occurrences are computed
+// in the location of the start time passed to Next, so they keep their
+// wall clock time across daylight saving changes; see tz.Date for how
+// skipped and repeated times are resolved.
+type Recurrence struct {
+	Frequency Frequency `json:"frequency"`
+	// Interval is the number of frequency units between periods; zero
+	// means one.
+	Interval int `json:"interval,omitempty"`
+	// ByWeekday limits or, for weekly and monthly rules, expands the days
+	// an occurrence can fall on.
+	ByWeekday []Weekday `json:"by_weekday,omitempty"`
+	// ByMonthDay lists days of the month; negative values count from the
+	// end of the month, so -1 is the last day.
+	ByMonthDay []int `json:"by_month_day,omitempty"`
+	// TimeOfDay is the wall clock time ("15:04") occurrences happen at.
+	// It defaults to the time of day of the start.
+	TimeOfDay string `json:"time_of_day,omitempty"`
+	// ByHour and ByMinute list several wall clock hours and minutes, as
+	// in an RRULE. Either overrides the matching part of TimeOfDay.
+	ByHour   []int `json:"by_hour,omitempty"`
+	ByMinute []int `json:"by_minute,omitempty"`
+	// Until ends the recurrence after the given instant.
+	Until *time.Time `json:"until,omitempty"`
+	// Count ends the recurrence after the given number of occurrences.
+	Count int `json:"count,omitempty"`
+	// ExDates are occurrences to leave out and RDates are extra ones to
+	// add, as with the EXDATE and RDATE properties.
+	ExDates []time.Time `json:"exdates,omitempty"`
+	RDates  []time.Time `json:"rdates,omitempty"`
+}
+
+// Validate reports whether the recurrence is well formed.
+func (r Recurrence) Validate() error {
+	switch r.Frequency {
+	case Hourly, Daily, Weekly, Monthly, Yearly:
+	case "":
+		return errors.New("frequency is required")
+	default:
+		return fmt.Errorf("unknown frequency %q", r.Frequency)
+	}
+
+	if r.Interval < 0 {
+		return errors.New("interval must not be negative")
+	}
+
+	for _, day := range r.ByWeekday {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("invalid weekday %d", day)
+		}
+	}
+
+	for _, day := range r.ByMonthDay {
+		if day == 0 || day < -31 || day > 31 {
+			return fmt.Errorf("invalid day of month %d", day)
+		}
+	}
+
+	if r.TimeOfDay != "" {
+		if _, err := time.Parse("15:04", r.TimeOfDay); err != nil {
+			return fmt.Errorf("invalid time of day %q", r.TimeOfDay)
+		}
+	}
+
+	for _, hour := range r.ByHour {
+		if hour < 0 || hour > 23 {
+			return fmt.Errorf("invalid hour %d", hour)
+		}
+	}
+
+	for _, minute := range r.ByMinute {
+		if minute < 0 || minute > 59 {
+			return fmt.Errorf("invalid minute %d", minute)
+		}
+	}
+
+	if r.Count < 0 {
+		return errors.New("count must not be negative")
+	}
+
+	if r.Count > 0 && r.Until != nil {
+		return errors.New("count and until cannot both be set")
+	}
+
+	return nil
+}
+
+// Next returns the first occurrence strictly after after, for a series
+// starting at start. It returns false when the series has ended.
+func (r Recurrence) Next(start, after time.Time) (time.Time, bool) {
+	next, ok := r.nextFromRule(start, after)
+	for ok && r.excluded(next) {
+		next, ok = r.nextFromRule(start, next)
+	}
+
+	for _, date := range r.RDates {
+		if date.After(after) && !r.excluded(date) && (!ok || date.Before(next)) {
+			next, ok = date, true
+		}
+	}
+
+	return next, ok
+}
+
+func (r Recurrence) excluded(t time.Time) bool {
+	for _, date := range r.ExDates {
+		if date.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextFromRule is Next without EXDATE and RDATE.
+func (r Recurrence) nextFromRule(start, after time.Time) (time.Time, bool) {
+	interval := max(r.Interval, 1)
+	hours, minutes := r.timesOfDay(start)
+
+	// Without a count, periods that end before after can be skipped
+	// outright instead of being walked one by one.
+	period := 0
+	if r.Count == 0 && after.After(start) {
+		period = max(r.unitsBetween(start, after)/interval-1, 0)
+	}
+
+	occurrences := 0
+	for i := 0; i < maxPeriods; i, period = i+1, period+1 {
+		for _, t := range r.expand(start, period*interval, hours, minutes) {
+			if t.Before(start) {
+				continue
+			}
+
+			occurrences++
+
+			if r.Until != nil && t.After(*r.Until) {
+				return time.Time{}, false
+			}
+
+			if r.Count > 0 && occurrences > r.Count {
+				return time.Time{}, false
+			}
+
+			if t.After(after) {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// First returns the first occurrence at or after start.
+func (r Recurrence) First(start time.Time) (time.Time, bool) {
+	return r.Next(start, start.Add(-time.Nanosecond))
+}
+
+// timesOfDay returns the sorted wall clock hours and minutes occurrences
+// can happen at.
+func (r Recurrence) timesOfDay(start time.Time) (hours, minutes []int) {
+	hour, minute := start.Hour(), start.Minute()
+	if t, err := time.Parse("15:04", r.TimeOfDay); err == nil {
+		hour, minute = t.Hour(), t.Minute()
+	}
+
+	hours = []int{hour}
+	if len(r.ByHour) > 0 {
+		hours = slices.Compact(slices.Sorted(slices.Values(r.ByHour)))
+	}
+
+	minutes = []int{minute}
+	if len(r.ByMinute) > 0 {
+		minutes = slices.Compact(slices.Sorted(slices.Values(r.ByMinute)))
+	}
+
+	return hours, minutes
+}
+
+// unitsBetween approximates how many frequency units lie between a and b.
+// It may undercount but never overcounts.
+func (r Recurrence) unitsBetween(a, b time.Time) int {
+	switch r.Frequency {
+	case Hourly:
+		return int(b.Sub(a) / time.Hour)
+	case Daily:
+		return int(b.Sub(a)/(24*time.Hour)) - 1
+	case Weekly:
+		return int(b.Sub(a)/(7*24*time.Hour)) - 1
+	case Monthly:
+		return (b.Year()-a.Year())*12 + int(b.Month()) - int(a.Month()) - 1
+	case Yearly:
+		return b.Year() - a.Year() - 1
+	}
+	return 0
+}
+
+// expand returns the sorted candidate occurrences in the period that is
+// offset frequency units after the one containing start.
+func (r Recurrence) expand(start time.Time, offset int, hours, minutes []int) []time.Time {
+	loc := start.Location()
+	year, month, day := start.Date()
+
+	var days []time.Time
+
+	switch r.Frequency {
+	case Hourly:
+		hour := time.Date(year, month, day, start.Hour(), 0, 0, 0, loc).Add(time.Duration(offset) * time.Hour)
+		if len(r.ByHour) > 0 && !slices.Contains(r.ByHour, hour.Hour()) {
+			return nil
+		}
+		var candidates []time.Time
+		for _, minute := range minutes {
+			t := hour.Add(time.Duration(minute) * time.Minute)
+			if r.matchesDay(t) {
+				candidates = append(candidates, t)
+			}
+		}
+		return candidates
+	case Daily:
+		d := time.Date(year, month, day+offset, 0, 0, 0, 0, loc)
+		if r.matchesDay(d) {
+			days = append(days, d)
+		}
+	case Weekly:
+		sinceMonday := (int(start.Weekday()) + 6) % 7
+		monday := time.Date(year, month, day-sinceMonday+7*offset, 0, 0, 0, 0, loc)
+		for i := 0; i < 7; i++ {
+			d := monday.AddDate(0, 0, i)
+			if len(r.ByWeekday) == 0 && d.Weekday() != start.Weekday() {
+				continue
+			}
+			if r.matchesDay(d) {
+				days = append(days, d)
+			}
+		}
+	case Monthly:
+		days = r.daysInMonth(time.Date(year, month+time.Month(offset), 1, 0, 0, 0, 0, loc), day)
+	case Yearly:
+		days = r.daysInMonth(time.Date(year+offset, month, 1, 0, 0, 0, 0, loc), day)
+	}
+
+	var candidates []time.Time
+	for _, d := range days {
+		for _, hour := range hours {
+			for _, minute := range minutes {
+				candidates = append(candidates, tz.Date(d.Year(), d.Month(), d.Day(), hour, minute, 0, loc))
+			}
+		}
+	}
+
+	// Times skipped by a daylight saving change can collide with the
+	// times after them
+	return slices.CompactFunc(candidates, time.Time.Equal)
+}
+
+// daysInMonth expands a monthly or yearly period starting at first. Without
+// any by-day rule the day of month of the start is used, and months that
+// lack it are skipped.
+func (r Recurrence) daysInMonth(first time.Time, startDay int) []time.Time {
+	var days []time.Time
+	for d := first; d.Month() == first.Month(); d = d.AddDate(0, 0, 1) {
+		switch {
+		case len(r.ByMonthDay) > 0 || len(r.ByWeekday) > 0:
+			if r.matchesDay(d) {
+				days = append(days, d)
+			}
+		case d.Day() == startDay:
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// matchesDay reports whether t satisfies the by-weekday and by-month-day
+// rules.
+func (r Recurrence) matchesDay(t time.Time) bool {
+	if len(r.ByWeekday) > 0 && !slices.Contains(r.ByWeekday, Weekday(t.Weekday())) {
+		return false
+	}
+
+	if len(r.ByMonthDay) > 0 {
+		lastDay := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+		matched := false
+		for _, day := range r.ByMonthDay {
+			if day == t.Day() || lastDay+day+1 == t.Day() {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String describes the recurrence in plain words, e.g.
+// "every 2 weeks on MO,WE at 09:00 until 2024-12-31".
+func (r Recurrence) String() string {
+	var b strings.Builder
+
+	interval := max(r.Interval, 1)
+	if interval == 1 {
+		b.WriteString(string(r.Frequency))
+	} else {
+		units := map[Frequency]string{Hourly: "hours", Daily: "days", Weekly: "weeks", Monthly: "months", Yearly: "years"}
+		fmt.Fprintf(&b, "every %d %s", interval, units[r.Frequency])
+	}
+
+	if len(r.ByWeekday) > 0 {
+		b.WriteString(" on " + FormatWeekdays(r.ByWeekday))
+	}
+
+	if len(r.ByMonthDay) > 0 {
+		b.WriteString(" on day " + formatInts(r.ByMonthDay))
+	}
+
+	if r.TimeOfDay != "" {
+		b.WriteString(" at " + r.TimeOfDay)
+	}
+
+	if len(r.ByHour) > 0 {
+		b.WriteString(" at hour " + formatInts(r.ByHour))
+	}
+
+	if len(r.ByMinute) > 0 {
+		b.WriteString(" at minute " + formatInts(r.ByMinute))
+	}
+
+	if r.Until != nil {
+		b.WriteString(" until " + r.Until.Format(time.DateOnly))
+	}
+
+	if r.Count > 0 {
+		fmt.Fprintf(&b, " for %d occurrences", r.Count)
+	}
+
+	return b.String()
+}
+
+func formatInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,152 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNext(t *testing.T) {
+	until := date("2024-01-03 23:59")
+
+	tests := []struct {
+		name     string
+		rule     Recurrence
+		start    string
+		after    string
+		expected string
+	}{
+		{"daily", Recurrence{Frequency: Daily}, "2024-01-01 09:00", "2024-01-05 10:00", "2024-01-06 09:00"},
+		{"daily at time", Recurrence{Frequency: Daily, TimeOfDay: "18:30"}, "2024-01-01 09:00", "2024-01-01 09:00", "2024-01-01 18:30"},
+		{"every other day", Recurrence{Frequency: Daily, Interval: 2}, "2024-01-01 09:00", "2024-01-01 09:00", "2024-01-03 09:00"},
+		{"weekly by weekday", Recurrence{Frequency: Weekly, ByWeekday: []Weekday{1, 3}}, "2024-01-01 09:00", "2024-01-01 09:00", "2024-01-03 09:00"},
+		{"biweekly", Recurrence{Frequency: Weekly, Interval: 2, ByWeekday: []Weekday{1}}, "2024-01-01 09:00", "2024-01-01 09:00", "2024-01-15 09:00"},
+		{"monthly last day", Recurrence{Frequency: Monthly, ByMonthDay: []int{-1}}, "2024-01-31 09:00", "2024-01-31 09:00", "2024-02-29 09:00"},
+		{"monthly skips short months", Recurrence{Frequency: Monthly}, "2024-01-31 09:00", "2024-01-31 09:00", "2024-03-31 09:00"},
+		{"yearly", Recurrence{Frequency: Yearly}, "2024-03-15 09:00", "2024-03-15 09:00", "2025-03-15 09:00"},
+		{"hourly weekdays", Recurrence{Frequency: Hourly, ByWeekday: []Weekday{1}}, "2024-01-05 23:15", "2024-01-05 23:15", "2024-01-08 00:15"},
+		{"first occurrence", Recurrence{Frequency: Daily, TimeOfDay: "08:00"}, "2024-01-01 09:00", "2024-01-01 08:59", "2024-01-02 08:00"},
+		{"far future", Recurrence{Frequency: Hourly}, "2020-01-01 00:00", "2024-06-01 12:30", "2024-06-01 13:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); err != nil {
+				t.Fatalf("Validate() returned error: %v", err)
+			}
+
+			next, ok := tt.rule.Next(date(tt.start), date(tt.after))
+			if !ok {
+				t.Fatalf("expected an occurrence")
+			}
+
+			if !next.Equal(date(tt.expected)) {
+				t.Errorf("expected %s; got %s", tt.expected, next.Format("2006-01-02 15:04"))
+			}
+		})
+	}
+
+	t.Run("count", func(t *testing.T) {
+		rule := Recurrence{Frequency: Daily, Count: 3}
+		if _, ok := rule.Next(date("2024-01-01 09:00"), date("2024-01-03 09:00")); ok {
+			t.Errorf("expected the recurrence to end after three occurrences")
+		}
+	})
+
+	t.Run("until", func(t *testing.T) {
+		rule := Recurrence{Frequency: Daily, Until: &until}
+		if _, ok := rule.Next(date("2024-01-01 09:00"), date("2024-01-03 09:00")); ok {
+			t.Errorf("expected the recurrence to end at until")
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	until := date("2024-01-03 23:59")
+
+	invalid := []Recurrence{
+		{},
+		{Frequency: "fortnightly"},
+		{Frequency: Daily, Interval: -1},
+		{Frequency: Monthly, ByMonthDay: []int{0}},
+		{Frequency: Daily, TimeOfDay: "25:00"},
+		{Frequency: Daily, Count: 2, Until: &until},
+	}
+
+	for _, rule := range invalid {
+		if rule.Validate() == nil {
+			t.Errorf("expected %+v to be invalid", rule)
+		}
+	}
+}
+
+func TestParseLegacy(t *testing.T) {
+	tests := map[string]Recurrence{
+		"daily":         {Frequency: Daily, Interval: 1},
+		"Weekly":        {Frequency: Weekly, Interval: 1},
+		"2d":            {Frequency: Daily, Interval: 2},
+		"24h":           {Frequency: Daily, Interval: 1},
+		"6h":            {Frequency: Hourly, Interval: 6},
+		"every 3 weeks": {Frequency: Weekly, Interval: 3},
+		"every month":   {Frequency: Monthly, Interval: 1},
+	}
+
+	for interval, expected := range tests {
+		r, err := ParseLegacy(interval, "")
+		if err != nil {
+			t.Errorf("ParseLegacy(%q) returned error: %v", interval, err)
+			continue
+		}
+		if r.Frequency != expected.Frequency || r.Interval != expected.Interval {
+			t.Errorf("ParseLegacy(%q) = %+v; expected %+v", interval, r, expected)
+		}
+	}
+
+	for _, interval := range []string{"sometimes", "90m", "every blue moon"} {
+		if _, err := ParseLegacy(interval, ""); err == nil {
+			t.Errorf("expected ParseLegacy(%q) to fail", interval)
+		}
+	}
+
+	r, err := ParseLegacy("daily", "2024-12-31")
+	if err != nil {
+		t.Fatalf("ParseLegacy() returned error: %v", err)
+	}
+	if r.Until == nil || r.Until.Format(time.DateOnly) != "2024-12-31" {
+		t.Errorf("expected until 2024-12-31; got %v", r.Until)
+	}
+}
+
+func TestNextAcrossDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("cannot load time zone: %v", err)
+	}
+
+	rule := Recurrence{Frequency: Daily, TimeOfDay: "09:00"}
+	start := time.Date(2024, 3, 8, 9, 0, 0, 0, loc)
+
+	next := start
+	for i := 0; i < 3; i++ {
+		var ok bool
+		if next, ok = rule.Next(start, next); !ok {
+			t.Fatalf("expected an occurrence")
+		}
+		if next.Hour() != 9 || next.Minute() != 0 {
+			t.Errorf("expected 09:00 local; got %s", next)
+		}
+	}
+
+	skipped := Recurrence{Frequency: Daily, TimeOfDay: "02:30"}
+	next, _ = skipped.Next(start, time.Date(2024, 3, 10, 0, 0, 0, 0, loc))
+	if next.Format(time.RFC3339) != "2024-03-10T03:30:00-04:00" {
+		t.Errorf("expected the skipped time to move forward; got %s", next.Format(time.RFC3339))
+	}
+}
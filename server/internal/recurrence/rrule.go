@@ -0,0 +1,227 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/internal/tz"
+)
+
+// Parsed is the result of ParseRRule.
+type Parsed struct {
+	Recurrence Recurrence
+	// Start is set when the text contained a DTSTART line.
+	Start *time.Time
+}
+
+// ParseRRule parses an RFC 5545 recurrence rule such as
+// "FREQ=WEEKLY;BYDAY=MO,WE;BYHOUR=9". The text may also hold several
+// content lines, e.g. "DTSTART:...", "RRULE:...", "EXDATE:..." and
+// "RDATE:...", one per line, as copied from a calendar.
+//
+// Dates without a trailing Z or a TZID parameter are floating and are read
+// in loc.
+//
+// BYSETPOS, BYMONTH, BYWEEKNO, BYYEARDAY, ordinal BYDAY values such as
+// "1MO" and sub-minute BYSECOND values are not supported.
+func ParseRRule(text string, loc *time.Location) (Parsed, error) {
+	var parsed Parsed
+	var sawRule bool
+
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			// A bare rule without the RRULE: prefix
+			name, value = "RRULE", line
+		}
+
+		name, params, _ := strings.Cut(name, ";")
+
+		switch strings.ToUpper(name) {
+		case "RRULE":
+			if sawRule {
+				return parsed, errors.New("only one RRULE is supported")
+			}
+			sawRule = true
+
+			exDates, rDates := parsed.Recurrence.ExDates, parsed.Recurrence.RDates
+			r, err := parseRule(value, loc)
+			if err != nil {
+				return parsed, err
+			}
+			r.ExDates, r.RDates = exDates, rDates
+			parsed.Recurrence = r
+		case "DTSTART":
+			dates, err := parseDateList(value, params, loc)
+			if err != nil || len(dates) != 1 {
+				return parsed, fmt.Errorf("invalid DTSTART %q", value)
+			}
+			parsed.Start = &dates[0]
+		case "EXDATE":
+			dates, err := parseDateList(value, params, loc)
+			if err != nil {
+				return parsed, fmt.Errorf("invalid EXDATE: %v", err)
+			}
+			parsed.Recurrence.ExDates = append(parsed.Recurrence.ExDates, dates...)
+		case "RDATE":
+			dates, err := parseDateList(value, params, loc)
+			if err != nil {
+				return parsed, fmt.Errorf("invalid RDATE: %v", err)
+			}
+			parsed.Recurrence.RDates = append(parsed.Recurrence.RDates, dates...)
+		default:
+			return parsed, fmt.Errorf("unsupported property %q", name)
+		}
+	}
+
+	if !sawRule {
+		return parsed, errors.New("missing RRULE")
+	}
+
+	return parsed, parsed.Recurrence.Validate()
+}
+
+func parseRule(rule string, loc *time.Location) (Recurrence, error) {
+	var r Recurrence
+
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return r, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		var err error
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch strings.ToUpper(value) {
+			case "HOURLY", "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.Frequency = Frequency(strings.ToLower(value))
+			default:
+				return r, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count <= 0 {
+				err = errors.New("must be positive")
+			}
+		case "UNTIL":
+			var until time.Time
+			until, err = parseDate(value, loc)
+			if len(value) == len("20060102") {
+				// A date-only UNTIL includes the whole day.
+				until = until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			r.Until = &until
+		case "BYDAY":
+			r.ByWeekday, err = ParseWeekdays(value)
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseIntList(value)
+		case "BYHOUR":
+			r.ByHour, err = parseIntList(value)
+		case "BYMINUTE":
+			r.ByMinute, err = parseIntList(value)
+		case "BYSECOND":
+			if value != "0" {
+				err = errors.New("only 0 is supported")
+			}
+		case "WKST":
+			// Weeks always start on Monday, which is also the default.
+			if strings.ToUpper(value) != "MO" {
+				err = errors.New("only MO is supported")
+			}
+		default:
+			return r, fmt.Errorf("unsupported rule part %q", key)
+		}
+
+		if err != nil {
+			return r, fmt.Errorf("invalid %s %q: %v", strings.ToUpper(key), value, err)
+		}
+	}
+
+	if r.Frequency == "" {
+		return r, errors.New("FREQ is required")
+	}
+
+	return r, nil
+}
+
+func parseIntList(value string) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(value, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// parseDateList parses the comma separated dates of a DTSTART, EXDATE or
+// RDATE line, honouring a TZID parameter. The TZID must name an IANA zone;
+// "Local" is rejected like in user time zones, and so is an empty one.
+func parseDateList(value, params string, loc *time.Location) ([]time.Time, error) {
+	for _, param := range strings.Split(params, ";") {
+		key, tzid, found := strings.Cut(param, "=")
+		if !found || strings.ToUpper(key) != "TZID" {
+			continue
+		}
+
+		if tzid == "" {
+			return nil, errors.New("empty TZID")
+		}
+
+		var err error
+		if loc, err = tz.Load(tzid); err != nil {
+			return nil, fmt.Errorf("invalid TZID: %v", err)
+		}
+	}
+
+	var dates []time.Time
+	for _, part := range strings.Split(value, ",") {
+		date, err := parseDate(part, loc)
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+	}
+	return dates, nil
+}
+
+// parseDate parses an iCalendar DATE or DATE-TIME. Times without a
+// trailing Z are read in loc.
+func parseDate(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
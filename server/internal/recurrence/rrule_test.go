@@ -0,0 +1,98 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	parsed, err := ParseRRule("FREQ=WEEKLY;BYDAY=MO,WE;BYHOUR=9;BYMINUTE=0;COUNT=3", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseRRule() returned error: %v", err)
+	}
+
+	r := parsed.Recurrence
+	start := date("2024-01-01 08:00")
+
+	var got []string
+	for next, ok := r.First(start); ok; next, ok = r.Next(start, next) {
+		got = append(got, next.Format("2006-01-02 15:04"))
+	}
+
+	expected := []string{"2024-01-01 09:00", "2024-01-03 09:00", "2024-01-08 09:00"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected occurrences %v; got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected occurrences %v; got %v", expected, got)
+			break
+		}
+	}
+}
+
+func TestParseRRuleSet(t *testing.T) {
+	text := "DTSTART:20240101T090000Z\nRRULE:FREQ=DAILY;UNTIL=20240105\nEXDATE:20240102T090000Z\nRDATE:20240110T120000Z"
+
+	parsed, err := ParseRRule(text, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseRRule() returned error: %v", err)
+	}
+
+	if parsed.Start == nil || !parsed.Start.Equal(date("2024-01-01 09:00")) {
+		t.Fatalf("expected DTSTART to be parsed; got %v", parsed.Start)
+	}
+
+	r := parsed.Recurrence
+
+	var got []string
+	for next, ok := r.First(*parsed.Start); ok; next, ok = r.Next(*parsed.Start, next) {
+		got = append(got, next.Format("01-02 15:04"))
+	}
+
+	expected := []string{"01-01 09:00", "01-03 09:00", "01-04 09:00", "01-05 09:00", "01-10 12:00"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected occurrences %v; got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected occurrences %v; got %v", expected, got)
+			break
+		}
+	}
+}
+
+func TestParseRRuleTZID(t *testing.T) {
+	parsed, err := ParseRRule("RRULE:FREQ=DAILY\nEXDATE;TZID=America/New_York:20240102T090000", time.UTC)
+	if err != nil {
+		t.Fatalf("ParseRRule() returned error: %v", err)
+	}
+
+	expected := time.Date(2024, 1, 2, 14, 0, 0, 0, time.UTC)
+	if len(parsed.Recurrence.ExDates) != 1 || !parsed.Recurrence.ExDates[0].Equal(expected) {
+		t.Errorf("expected EXDATE %v; got %v", expected, parsed.Recurrence.ExDates)
+	}
+}
+
+func TestParseRRuleInvalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"BYDAY=MO",
+		"FREQ=SECONDLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=2;UNTIL=20240101",
+		"FREQ=MONTHLY;BYDAY=1MO",
+		"FREQ=YEARLY;BYMONTH=3",
+		"FREQ=DAILY;BYHOUR=24",
+		"RRULE:FREQ=DAILY\nRRULE:FREQ=WEEKLY",
+		"RRULE:FREQ=DAILY\nEXDATE;TZID=Mars/Olympus:20240102T090000",
+		"RRULE:FREQ=DAILY\nEXDATE;TZID=Local:20240102T090000",
+		"RRULE:FREQ=DAILY\nDTSTART;TZID=:20240102T090000",
+	}
+
+	for _, text := range invalid {
+		if _, err := ParseRRule(text, time.UTC); err == nil {
+			t.Errorf("expected ParseRRule(%q) to fail", text)
+		}
+	}
+}
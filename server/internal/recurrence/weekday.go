@@ -0,0 +1,70 @@
+package recurrence
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Weekday is a day of the week that encodes as its two letter iCalendar
+// abbreviation ("MO", "TU", ...).
+type Weekday time.Weekday
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// ParseWeekday parses a two letter abbreviation such as "MO".
+func ParseWeekday(s string) (Weekday, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for i, name := range weekdayNames {
+		if name == s {
+			return Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", s)
+}
+
+func (w Weekday) String() string {
+	if w < 0 || int(w) >= len(weekdayNames) {
+		return fmt.Sprintf("Weekday(%d)", int(w))
+	}
+	return weekdayNames[w]
+}
+
+func (w Weekday) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+func (w *Weekday) UnmarshalText(text []byte) error {
+	day, err := ParseWeekday(string(text))
+	if err != nil {
+		return err
+	}
+	*w = day
+	return nil
+}
+
+// FormatWeekdays joins weekdays with commas, e.g. "MO,WE".
+func FormatWeekdays(days []Weekday) string {
+	names := make([]string, len(days))
+	for i, day := range days {
+		names[i] = day.String()
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseWeekdays parses a comma separated list produced by FormatWeekdays.
+func ParseWeekdays(s string) ([]Weekday, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var days []Weekday
+	for _, name := range strings.Split(s, ",") {
+		day, err := ParseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
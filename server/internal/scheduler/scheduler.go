@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"server/internal/dispatcher"
+)
+
+// Dispatcher runs a single dispatch pass.
+type Dispatcher interface {
+	Dispatch(ctx context.Context) (dispatcher.Summary, error)
+}
+
+// Scheduler runs a Dispatcher at a fixed interval in the background.
+type Scheduler struct {
+	dispatcher Dispatcher
+	interval   time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(d Dispatcher, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		dispatcher: d,
+		interval:   interval,
+	}
+}
+
+// Start begins ticking in a new goroutine. It must be called at most once.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go s.run(ctx)
+
+	log.Printf("Scheduler started, dispatching every %s", s.interval)
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			summary, err := s.dispatcher.Dispatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Scheduled dispatch failed: %v", err)
+				continue
+			}
+			if summary.Scanned > 0 {
+				log.Printf("Scheduled dispatch: %+v", summary)
+			}
+		}
+	}
+}
+
+// Stop prevents further ticks and waits for the current dispatch, if any,
+// to finish its in-flight delivery. It returns ctx.Err() if ctx expires
+// first.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("Scheduler stopped")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,46 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"server/internal/dispatcher"
+)
+
+type countingDispatcher struct {
+	runs atomic.Int32
+}
+
+func (c *countingDispatcher) Dispatch(ctx context.Context) (dispatcher.Summary, error) {
+	c.runs.Add(1)
+	return dispatcher.Summary{}, nil
+}
+
+func TestSchedulerTicksUntilStopped(t *testing.T) {
+	d := &countingDispatcher{}
+
+	s := New(d, 10*time.Millisecond)
+	s.Start()
+
+	time.Sleep(55 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop() returned error: %v", err)
+	}
+
+	runs := d.runs.Load()
+	if runs == 0 {
+		t.Fatalf("expected the dispatcher to run at least once")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if d.runs.Load() != runs {
+		t.Errorf("expected no runs after Stop()")
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"server/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Authorization rules for the v1 API:
+//
+//   - Reminders are only visible to their owner. Another user's reminder
+//     is reported as not found, so IDs cannot be probed.
+//   - Routes naming a user, such as /reminders-user/:user_id, answer 403
+//     unless the caller is that user or an admin.
+//   - Routes behind AdminMiddleware answer 403 to everyone but admins.
+
+// callerID returns the ID of the user AuthMiddleware authenticated.
+func callerID(c *fiber.Ctx) int {
+	return c.Locals("user_id").(int)
+}
+
+// isAdmin reports whether the calling user has the admin role. The role is
+// read from the database so that changes apply without a new login.
+func (s *FiberServer) isAdmin(c *fiber.Ctx) (bool, error) {
+	user, err := s.db.GetUserById(callerID(c))
+	if err != nil {
+		return false, err
+	}
+	return user.Role == models.RoleAdmin, nil
+}
+
+// AdminMiddleware only lets admins through. It must run after
+// AuthMiddleware.
+func (s *FiberServer) AdminMiddleware(c *fiber.Ctx) error {
+	admin, err := s.isAdmin(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	if !admin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Forbidden",
+		})
+	}
+
+	return c.Next()
+}
+
+// ownedReminder loads the reminder named by the :id route parameter and
+// checks that it belongs to the calling user. The returned *fiber.Error
+// carries the status and message to respond with otherwise.
+func (s *FiberServer) ownedReminder(c *fiber.Ctx) (models.Reminder, *fiber.Error) {
+	reminderId, err := strconv.Atoi(strings.TrimSpace(c.Params("id")))
+
+	if err != nil {
+		return models.Reminder{}, fiber.NewError(fiber.StatusBadRequest, "Invalid reminder ID")
+	}
+
+	reminder, err := s.db.GetReminderById(reminderId)
+
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && reminder.UserID != callerID(c)) {
+		return models.Reminder{}, fiber.NewError(fiber.StatusNotFound, "Reminder not found")
+	}
+
+	if err != nil {
+		return models.Reminder{}, fiber.NewError(fiber.StatusInternalServerError, "Cannot get reminder")
+	}
+
+	return reminder, nil
+}
+
+// authorizedUserParam returns the :user_id route parameter if the caller
+// is that user or an admin.
+func (s *FiberServer) authorizedUserParam(c *fiber.Ctx) (int, *fiber.Error) {
+	userId, err := strconv.Atoi(strings.TrimSpace(c.Params("user_id")))
+
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	if userId == callerID(c) {
+		return userId, nil
+	}
+
+	admin, err := s.isAdmin(c)
+
+	if err != nil {
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "Cannot get user")
+	}
+
+	if !admin {
+		return 0, fiber.NewError(fiber.StatusForbidden, "Forbidden")
+	}
+
+	return userId, nil
+}
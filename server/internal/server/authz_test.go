@@ -0,0 +1,121 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"server/internal/database"
+	"server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeDB implements the parts of database.Service the authorization tests
+// need; calling anything else panics.
+type fakeDB struct {
+	database.Service
+	users     map[int]models.User
+	reminders map[int]models.Reminder
+}
+
+func (f *fakeDB) GetUserById(id int) (models.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (f *fakeDB) GetReminderById(id int) (models.Reminder, error) {
+	reminder, ok := f.reminders[id]
+	if !ok {
+		return reminder, sql.ErrNoRows
+	}
+	return reminder, nil
+}
+
+func (f *fakeDB) GetAllRemindersForUser(userId int) ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	for _, reminder := range f.reminders {
+		if reminder.UserID == userId {
+			reminders = append(reminders, reminder)
+		}
+	}
+	return reminders, nil
+}
+
+func (f *fakeDB) GetAllReminders() ([]models.Reminder, error) {
+	var reminders []models.Reminder
+	for _, reminder := range f.reminders {
+		reminders = append(reminders, reminder)
+	}
+	return reminders, nil
+}
+
+func newAuthzApp(callerId int) *fiber.App {
+	app := fiber.New()
+	s := &FiberServer{
+		App: app,
+		db: &fakeDB{
+			users: map[int]models.User{
+				1: {ID: 1, Role: models.RoleUser},
+				2: {ID: 2, Role: models.RoleUser},
+				3: {ID: 3, Role: models.RoleAdmin},
+			},
+			reminders: map[int]models.Reminder{
+				10: {ID: 10, UserID: 1},
+				20: {ID: 20, UserID: 2},
+			},
+		},
+	}
+
+	// Stand in for AuthMiddleware
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", callerId)
+		return c.Next()
+	})
+
+	app.Get("/reminder/:id", s.GetRemindersHandler)
+	app.Get("/reminders-user/:user_id", s.GetRemindersForUserHandler)
+	app.Get("/all-reminders", s.AdminMiddleware, s.GetAllRemindersHandler)
+
+	return app
+}
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   int
+		path     string
+		expected int
+	}{
+		{"own reminder", 1, "/reminder/10", http.StatusOK},
+		{"other user's reminder", 1, "/reminder/20", http.StatusNotFound},
+		{"missing reminder", 1, "/reminder/30", http.StatusNotFound},
+		{"invalid reminder ID", 1, "/reminder/abc", http.StatusBadRequest},
+		{"own reminders", 1, "/reminders-user/1", http.StatusOK},
+		{"other user's reminders", 1, "/reminders-user/2", http.StatusForbidden},
+		{"admin reading other user's reminders", 3, "/reminders-user/2", http.StatusOK},
+		{"all reminders as user", 1, "/all-reminders", http.StatusForbidden},
+		{"all reminders as admin", 3, "/all-reminders", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+
+			resp, err := newAuthzApp(tt.caller).Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+
+			if resp.StatusCode != tt.expected {
+				t.Errorf("expected status %d; got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
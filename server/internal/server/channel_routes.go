@@ -0,0 +1,368 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/mail"
+	"net/url"
+	"server/internal/models"
+	"server/internal/notify"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// resolveTimeout bounds looking up the host of a channel URL.
+const resolveTimeout = 5 * time.Second
+
+// channelKinds lists the channels users can register and how their address
+// and secret are validated.
+var channelKinds = map[string]func(address, secret string) error{
+	models.ChannelEmail:   validateEmailChannel,
+	models.ChannelWebhook: validateWebhookChannel,
+	models.ChannelSlack:   validateChatChannel,
+	models.ChannelDiscord: validateChatChannel,
+	models.ChannelNtfy:    validateNtfyChannel,
+	models.ChannelGotify:  validateGotifyChannel,
+}
+
+func validateEmailChannel(address, secret string) error {
+	if _, err := mail.ParseAddress(address); err != nil {
+		return errors.New("address must be an email address")
+	}
+	return nil
+}
+
+func validateWebhookChannel(address, secret string) error {
+	if err := validateHTTPURL(address); err != nil {
+		return err
+	}
+
+	if secret == "" {
+		return errors.New("webhook channels need a secret to sign deliveries with")
+	}
+
+	return nil
+}
+
+// validateChatChannel checks the incoming webhook URL of a chat channel,
+// which carries its own credentials.
+func validateChatChannel(address, secret string) error {
+	return validateHTTPURL(address)
+}
+
+// validateNtfyChannel checks the topic URL of an ntfy channel. The access
+// token is optional for public servers.
+func validateNtfyChannel(address, secret string) error {
+	if err := validateHTTPURL(address); err != nil {
+		return err
+	}
+
+	u, _ := url.Parse(address)
+	if strings.Trim(u.Path, "/") == "" {
+		return errors.New("address must include the topic, such as https://ntfy.sh/my-reminders")
+	}
+
+	return nil
+}
+
+func validateGotifyChannel(address, secret string) error {
+	if err := validateHTTPURL(address); err != nil {
+		return err
+	}
+
+	if secret == "" {
+		return errors.New("gotify channels need an application token")
+	}
+
+	return nil
+}
+
+// validateHTTPURL checks that address is an absolute http or https URL of
+// a public host. Notifiers check the address again when they connect, in
+// case the host resolves differently by then.
+func validateHTTPURL(address string) error {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("address must be an http or https URL")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	err = notify.CheckPublicHost(ctx, u.Hostname())
+
+	if errors.Is(err, notify.ErrPrivateAddress) {
+		return errors.New("address must be a public host")
+	}
+
+	if err != nil {
+		return errors.New("address host cannot be resolved")
+	}
+
+	return nil
+}
+
+func (s *FiberServer) GetChannelsHandler(c *fiber.Ctx) error {
+	channels, err := s.db.GetChannelsForUser(callerID(c))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get channels",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Channels retrieved successfully",
+		"data":    fiber.Map{"channels": channels},
+	})
+}
+
+func (s *FiberServer) CreateChannelHandler(c *fiber.Ctx) error {
+	type ChannelRequest struct {
+		Kind      string `json:"kind" xml:"kind" form:"kind"`
+		Address   string `json:"address" xml:"address" form:"address"`
+		Secret    string `json:"secret" xml:"secret" form:"secret"`
+		Enabled   *bool  `json:"enabled" xml:"enabled" form:"enabled"`
+		IsDefault bool   `json:"is_default" xml:"is_default" form:"is_default"`
+	}
+
+	req := new(ChannelRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	validate, ok := channelKinds[req.Kind]
+
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Unsupported channel kind",
+		})
+	}
+
+	if err := validate(req.Address, req.Secret); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	channel := models.Channel{
+		UserID:    callerID(c),
+		Kind:      req.Kind,
+		Address:   req.Address,
+		Secret:    req.Secret,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		IsDefault: req.IsDefault,
+	}
+
+	if ferr := s.checkEmailChannel(channel); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	if err := s.db.SaveChannel(&channel); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save channel",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Channel created successfully",
+		"data":    fiber.Map{"channel": channel},
+	})
+}
+
+// ownedChannel returns the channel named by the :id route parameter if it
+// belongs to the caller.
+func (s *FiberServer) ownedChannel(c *fiber.Ctx) (models.Channel, *fiber.Error) {
+	id, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+		return models.Channel{}, fiber.NewError(fiber.StatusBadRequest, "Invalid channel ID")
+	}
+
+	channel, err := s.db.GetChannel(id, callerID(c))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return channel, fiber.NewError(fiber.StatusNotFound, "Channel not found")
+	}
+
+	if err != nil {
+		return channel, fiber.NewError(fiber.StatusInternalServerError, "Cannot get channel")
+	}
+
+	return channel, nil
+}
+
+func (s *FiberServer) GetChannelHandler(c *fiber.Ctx) error {
+	channel, ferr := s.ownedChannel(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Channel retrieved successfully",
+		"data":    fiber.Map{"channel": channel},
+	})
+}
+
+// PatchChannelHandler changes the address, secret or flags of a channel.
+// The kind of a channel cannot change.
+func (s *FiberServer) PatchChannelHandler(c *fiber.Ctx) error {
+	type ChannelPatch struct {
+		Address   *string `json:"address" xml:"address" form:"address"`
+		Secret    *string `json:"secret" xml:"secret" form:"secret"`
+		Enabled   *bool   `json:"enabled" xml:"enabled" form:"enabled"`
+		IsDefault *bool   `json:"is_default" xml:"is_default" form:"is_default"`
+	}
+
+	channel, ferr := s.ownedChannel(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	patch := new(ChannelPatch)
+
+	if err := c.BodyParser(patch); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if patch.Address != nil || patch.Secret != nil {
+		validate, ok := channelKinds[channel.Kind]
+
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "The address of this channel cannot be changed",
+			})
+		}
+
+		if patch.Address != nil {
+			channel.Address = *patch.Address
+		}
+		if patch.Secret != nil {
+			channel.Secret = *patch.Secret
+		}
+
+		if err := validate(channel.Address, channel.Secret); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		if ferr := s.checkEmailChannel(channel); ferr != nil {
+			return c.Status(ferr.Code).JSON(fiber.Map{
+				"error": ferr.Message,
+			})
+		}
+	}
+
+	if patch.Enabled != nil {
+		channel.Enabled = *patch.Enabled
+	}
+	if patch.IsDefault != nil {
+		channel.IsDefault = *patch.IsDefault
+	}
+
+	err := s.db.UpdateChannel(&channel)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Channel not found",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update channel",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Channel updated successfully",
+		"data":    fiber.Map{"channel": channel},
+	})
+}
+
+// checkEmailChannel keeps email channels on the account address, as no
+// other address is ever verified. Otherwise anyone could send reminders to
+// third parties through the server.
+func (s *FiberServer) checkEmailChannel(channel models.Channel) *fiber.Error {
+	if channel.Kind != models.ChannelEmail {
+		return nil
+	}
+
+	user, err := s.db.GetUserById(channel.UserID)
+
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Cannot get user")
+	}
+
+	if !notify.SameAddress(channel.Address, user.Email) {
+		return fiber.NewError(fiber.StatusBadRequest, "Email channels must use your account address")
+	}
+
+	return nil
+}
+
+// checkReminderChannel checks that the channel a reminder is sent to, if
+// any, belongs to the owner of the reminder.
+func (s *FiberServer) checkReminderChannel(reminder models.Reminder) *fiber.Error {
+	if reminder.ChannelID == nil {
+		return nil
+	}
+
+	_, err := s.db.GetChannel(*reminder.ChannelID, reminder.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown channel")
+	}
+
+	if err != nil {
+		return fiber.NewError(fiber.StatusInternalServerError, "Cannot get channel")
+	}
+
+	return nil
+}
+
+func (s *FiberServer) DeleteChannelHandler(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid channel ID",
+		})
+	}
+
+	err = s.db.DeleteChannel(id, callerID(c))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Channel not found",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete channel",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Channel deleted successfully",
+	})
+}
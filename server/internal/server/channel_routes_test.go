@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestValidateHTTPURL(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"ftp://93.184.216.34/hook", false},
+		{"/hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://[fe80::1]/hook", false},
+	}
+
+	for _, tt := range tests {
+		if err := validateHTTPURL(tt.address); (err == nil) != tt.valid {
+			t.Errorf("validateHTTPURL(%q) returned %v; expected valid=%v", tt.address, err, tt.valid)
+		}
+	}
+}
+
+func TestEmailChannelsUseAccountAddress(t *testing.T) {
+	tests := []struct {
+		verification string
+		address      string
+		expected     int
+	}{
+		{verificationDelivery, "ada@example.com", http.StatusOK},
+		{verificationDelivery, "Ada <ADA@example.com>", http.StatusOK},
+		{verificationDelivery, "someone@example.com", http.StatusBadRequest},
+		{verificationLogin, "someone@example.com", http.StatusBadRequest},
+		{verificationOff, "someone@example.com", http.StatusBadRequest},
+		{verificationOff, "ada@example.com", http.StatusOK},
+		{"", "someone@example.com", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		db := &telegramDB{fakeDB: fakeDB{users: map[int]models.User{1: {ID: 1, Email: "ada@example.com"}}}}
+
+		app := fiber.New()
+		s := &FiberServer{App: app, db: db, emailVerification: tt.verification}
+
+		app.Post("/me/channels", func(c *fiber.Ctx) error {
+			c.Locals("user_id", 1)
+			return c.Next()
+		}, s.CreateChannelHandler)
+
+		req := httptest.NewRequest("POST", "/me/channels", strings.NewReader(`{"kind":"email","address":`+jsonString(tt.address)+`}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+
+		if resp.StatusCode != tt.expected {
+			t.Errorf("expected status %d for %q with EMAIL_VERIFICATION=%s; got %d", tt.expected, tt.address, tt.verification, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// deliveryListLimit caps how many deliveries GetDeliveriesHandler returns.
+const deliveryListLimit = 100
+
+// GetDeliveriesHandler lists the deliveries of the caller, or of every user
+// for admins, optionally filtered by status and reminder_id.
+func (s *FiberServer) GetDeliveriesHandler(c *fiber.Ctx) error {
+	filter := models.DeliveryFilter{
+		Status: c.Query("status"),
+		Limit:  c.QueryInt("limit", deliveryListLimit),
+	}
+
+	if filter.Status != "" && !models.ValidDeliveryStatus(filter.Status) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid status",
+		})
+	}
+
+	if filter.Limit < 1 || filter.Limit > deliveryListLimit {
+		filter.Limit = deliveryListLimit
+	}
+
+	if value := c.Query("reminder_id"); value != "" {
+		reminderId, err := strconv.Atoi(value)
+
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid reminder ID",
+			})
+		}
+
+		filter.ReminderID = reminderId
+	}
+
+	admin, err := s.isAdmin(c)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get user",
+		})
+	}
+
+	if !admin {
+		userId := callerID(c)
+		filter.UserID = &userId
+	}
+
+	deliveries, err := s.db.GetDeliveries(filter)
+
+	if err != nil {
+		fmt.Printf("Error getting deliveries: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get deliveries",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Deliveries retrieved successfully",
+		"data":    fiber.Map{"deliveries": deliveries},
+	})
+}
+
+// visibleDelivery returns the delivery named by the :id route parameter if
+// it belongs to the caller or the caller is an admin.
+func (s *FiberServer) visibleDelivery(c *fiber.Ctx) (models.Delivery, *fiber.Error) {
+	id, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+		return models.Delivery{}, fiber.NewError(fiber.StatusBadRequest, "Invalid delivery ID")
+	}
+
+	delivery, err := s.db.GetDelivery(id)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return delivery, fiber.NewError(fiber.StatusNotFound, "Delivery not found")
+	}
+
+	if err != nil {
+		return delivery, fiber.NewError(fiber.StatusInternalServerError, "Cannot get delivery")
+	}
+
+	if delivery.UserID == callerID(c) {
+		return delivery, nil
+	}
+
+	admin, err := s.isAdmin(c)
+
+	if err != nil {
+		return delivery, fiber.NewError(fiber.StatusInternalServerError, "Cannot get user")
+	}
+
+	if !admin {
+		return models.Delivery{}, fiber.NewError(fiber.StatusNotFound, "Delivery not found")
+	}
+
+	return delivery, nil
+}
+
+// GetDeliveryHandler returns a delivery together with its attempts.
+func (s *FiberServer) GetDeliveryHandler(c *fiber.Ctx) error {
+	delivery, ferr := s.visibleDelivery(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	attempts, err := s.db.GetDeliveryAttempts(delivery.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get delivery attempts",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Delivery retrieved successfully",
+		"data":    fiber.Map{"delivery": delivery, "attempts": attempts},
+	})
+}
+
+// RedriveDeliveryHandler gives a dead-lettered delivery a fresh set of
+// attempts and queues a job for the first, which the next free worker
+// runs right away.
+func (s *FiberServer) RedriveDeliveryHandler(c *fiber.Ctx) error {
+	delivery, ferr := s.visibleDelivery(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	err := s.db.RedriveDelivery(delivery.ID, time.Now())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only failed deliveries can be re-driven",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot re-drive delivery",
+		})
+	}
+
+	delivery, err = s.db.GetDelivery(delivery.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get delivery",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Delivery re-driven successfully",
+		"data":    fiber.Map{"delivery": delivery},
+	})
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// deliveryDB adds deliveries to fakeDB.
+type deliveryDB struct {
+	fakeDB
+	deliveries map[int]models.Delivery
+}
+
+func (f *deliveryDB) GetDelivery(id int) (models.Delivery, error) {
+	delivery, ok := f.deliveries[id]
+	if !ok {
+		return delivery, sql.ErrNoRows
+	}
+	return delivery, nil
+}
+
+func (f *deliveryDB) GetDeliveries(filter models.DeliveryFilter) ([]models.Delivery, error) {
+	var deliveries []models.Delivery
+	for _, delivery := range f.deliveries {
+		if filter.UserID != nil && delivery.UserID != *filter.UserID {
+			continue
+		}
+		if filter.Status != "" && delivery.Status != filter.Status {
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func (f *deliveryDB) RedriveDelivery(id int, now time.Time) error {
+	delivery, ok := f.deliveries[id]
+	if !ok || delivery.Status != models.DeliveryFailed {
+		return sql.ErrNoRows
+	}
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = &now
+	f.deliveries[id] = delivery
+	return nil
+}
+
+func TestDeliveries(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   int
+		method   string
+		path     string
+		expected int
+	}{
+		{"failed deliveries", 1, "GET", "/deliveries?status=failed", http.StatusOK},
+		{"unknown status", 1, "GET", "/deliveries?status=lost", http.StatusBadRequest},
+		{"re-drive own delivery", 1, "POST", "/deliveries/100/redrive", http.StatusOK},
+		{"re-drive delivered delivery", 1, "POST", "/deliveries/101/redrive", http.StatusConflict},
+		{"re-drive other user's delivery", 1, "POST", "/deliveries/200/redrive", http.StatusNotFound},
+		{"admin re-driving other user's delivery", 3, "POST", "/deliveries/200/redrive", http.StatusOK},
+		{"invalid delivery ID", 1, "POST", "/deliveries/abc/redrive", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &deliveryDB{
+				fakeDB: fakeDB{users: map[int]models.User{
+					1: {ID: 1, Role: models.RoleUser},
+					2: {ID: 2, Role: models.RoleUser},
+					3: {ID: 3, Role: models.RoleAdmin},
+				}},
+				deliveries: map[int]models.Delivery{
+					100: {ID: 100, UserID: 1, Status: models.DeliveryFailed, Attempts: 5},
+					101: {ID: 101, UserID: 1, Status: models.DeliveryDelivered, Attempts: 1},
+					200: {ID: 200, UserID: 2, Status: models.DeliveryFailed, Attempts: 5},
+				},
+			}
+
+			app := fiber.New()
+			s := &FiberServer{App: app, db: db}
+
+			// Stand in for AuthMiddleware
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("user_id", tt.caller)
+				return c.Next()
+			})
+
+			app.Get("/deliveries", s.GetDeliveriesHandler)
+			app.Post("/deliveries/:id/redrive", s.RedriveDeliveryHandler)
+
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			if err != nil {
+				t.Fatalf("error creating request. Err: %v", err)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+
+			if resp.StatusCode != tt.expected {
+				t.Errorf("expected status %d; got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"server/internal/dispatcher"
+	"server/internal/tz"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (s *FiberServer) GetMeHandler(c *fiber.Ctx) error {
+	userId := callerID(c)
+
+	user, err := s.db.GetUserById(userId)
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User retrieved successfully",
+		"data": fiber.Map{"user": fiber.Map{
+			"id":                user.ID,
+			"email":             user.Email,
+			"fname":             user.Fname,
+			"lname":             user.Lname,
+			"time_zone":         user.TimeZone,
+			"role":              user.Role,
+			"email_verified_at": user.EmailVerifiedAt,
+		}},
+	})
+}
+
+func (s *FiberServer) UpdateMeHandler(c *fiber.Ctx) error {
+	type UserUpdate struct {
+		TimeZone *string `json:"time_zone" xml:"time_zone" form:"time_zone"`
+	}
+
+	userId := callerID(c)
+
+	update := new(UserUpdate)
+
+	if err := c.BodyParser(update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if update.TimeZone != nil {
+		if _, err := tz.Load(*update.TimeZone); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid time zone",
+			})
+		}
+
+		if err := s.db.UpdateUserTimeZone(userId, *update.TimeZone); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot update time zone",
+			})
+		}
+
+		if err := s.rescheduleReminders(userId); err != nil {
+			fmt.Printf("Error rescheduling reminders of user %d: %v\n", userId, err)
+		}
+	}
+
+	return s.GetMeHandler(c)
+}
+
+// rescheduleReminders recomputes when the reminders of a user fire next,
+// after a change that moves their wall clock times such as a new time zone.
+func (s *FiberServer) rescheduleReminders(userId int) error {
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+
+	reminders, err := s.db.GetAllRemindersForUser(userId)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, reminder := range reminders {
+		// Reminders with their own time zone are unaffected, and ones that
+		// are already due fire at their current time.
+		if reminder.TimeZone != "" || reminder.NextFireAt == nil || !reminder.NextFireAt.After(now) || reminder.RecurrenceError != "" {
+			continue
+		}
+
+		loc, err := dispatcher.LocationFor(user, reminder)
+		if err != nil {
+			return err
+		}
+
+		schedule, err := dispatcher.ScheduleFor(reminder, loc)
+		if err != nil {
+			return err
+		}
+
+		next, ok := schedule.Next(now)
+		if !ok {
+			continue
+		}
+
+		if err := s.db.SetReminderNextFire(reminder.ID, &next); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
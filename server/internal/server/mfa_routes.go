@@ -0,0 +1,341 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/internal/models"
+	"server/internal/totp"
+	"server/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps.
+	totpIssuer = "Alertify"
+
+	// mfaChallengeTTL is how long a user has to enter their code after
+	// their password.
+	mfaChallengeTTL = 5 * time.Minute
+
+	// mfaChallengeAttempts is how many codes can be tried per challenge.
+	mfaChallengeAttempts = 5
+
+	// recoveryCodeCount is how many recovery codes a user gets.
+	recoveryCodeCount = 10
+
+	// recoveryCodeLength is the length of a recovery code, shown in two
+	// halves separated by a dash.
+	recoveryCodeLength = 10
+)
+
+// startMFAChallenge responds to a correct password of a user with an
+// authenticator with a challenge token, which LoginMFAHandler exchanges
+// for a session together with a code.
+func (s *FiberServer) startMFAChallenge(c *fiber.Ctx, user models.User) error {
+	token, err := utils.RandomToken(32)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	expiresAt := time.Now().Add(mfaChallengeTTL)
+
+	if err := s.db.CreateMFAChallenge(user.ID, utils.HashToken(token), expiresAt); err != nil {
+		fmt.Printf("Error creating MFA challenge: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"email":        user.Email,
+		"mfa_required": true,
+		"challenge":    token,
+		"expires_at":   expiresAt,
+	})
+}
+
+// LoginMFAHandler finishes a login with the challenge token from
+// LoginHandler and a code from the user's authenticator or one of their
+// recovery codes, and only then starts the session.
+func (s *FiberServer) LoginMFAHandler(c *fiber.Ctx) error {
+	type LoginMFA struct {
+		Challenge string `json:"challenge" xml:"challenge" form:"challenge"`
+		Code      string `json:"code" xml:"code" form:"code"`
+	}
+
+	body := new(LoginMFA)
+
+	if err := c.BodyParser(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	challengeHash := utils.HashToken(body.Challenge)
+
+	userId, err := s.db.AttemptMFAChallenge(challengeHash, time.Now(), mfaChallengeAttempts)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired challenge, log in again",
+		})
+	}
+
+	if err != nil {
+		fmt.Printf("Error attempting MFA challenge: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	ok, err := s.checkSecondFactor(userId, body.Code)
+
+	if err != nil {
+		fmt.Printf("Error checking second factor: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	}
+
+	// A challenge starts at most one session
+	if err := s.db.DeleteMFAChallenge(challengeHash); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired challenge, log in again",
+		})
+	}
+
+	user, err := s.db.GetUserById(userId)
+
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := s.startSession(c, user); err != nil {
+		fmt.Printf("Error starting session: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"email": user.Email,
+	})
+}
+
+// checkSecondFactor reports whether code is a code from the enabled
+// authenticator of a user that was not used before, or one of their unused
+// recovery codes. Either is used up by a successful check.
+func (s *FiberServer) checkSecondFactor(userId int, code string) (bool, error) {
+	credential, err := s.db.GetTOTP(userId)
+
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !credential.Enabled() {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if counter, ok := totp.Validate(credential.Secret, code, time.Now()); ok {
+		err = s.db.UseTOTPCounter(userId, counter)
+	} else {
+		err = s.db.UseRecoveryCode(userId, utils.HashToken(normalizeRecoveryCode(code)), time.Now())
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// normalizeRecoveryCode accepts recovery codes with or without the dash
+// and in either case.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// CreateTOTPHandler starts enrolling an authenticator for the caller. The
+// returned secret and otpauth:// URI are only asked for at login once
+// ConfirmTOTPHandler accepts a first code.
+func (s *FiberServer) CreateTOTPHandler(c *fiber.Ctx) error {
+	user, err := s.db.GetUserById(callerID(c))
+
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	secret, err := totp.GenerateSecret()
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot create authenticator secret",
+		})
+	}
+
+	err = s.db.SaveTOTPSecret(user.ID, secret)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	if err != nil {
+		fmt.Printf("Error saving TOTP secret: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot create authenticator secret",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Add the secret to your authenticator app and confirm it with a code",
+		"data": fiber.Map{
+			"secret": secret,
+			"uri":    totp.URI(totpIssuer, user.Email, secret),
+		},
+	})
+}
+
+// ConfirmTOTPHandler enables the caller's pending authenticator with a
+// first code and returns their recovery codes. They are only shown once.
+func (s *FiberServer) ConfirmTOTPHandler(c *fiber.Ctx) error {
+	type ConfirmTOTP struct {
+		Code string `json:"code" xml:"code" form:"code"`
+	}
+
+	body := new(ConfirmTOTP)
+
+	if err := c.BodyParser(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userId := callerID(c)
+
+	credential, err := s.db.GetTOTP(userId)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "No authenticator to confirm",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot confirm authenticator",
+		})
+	}
+
+	if credential.Enabled() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	counter, ok := totp.Validate(credential.Secret, body.Code, time.Now())
+
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := utils.RandomCode(recoveryCodeLength)
+
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot confirm authenticator",
+			})
+		}
+
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+		hashes[i] = utils.HashToken(code)
+	}
+
+	err = s.db.EnableTOTP(userId, counter, hashes, time.Now())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	if err != nil {
+		fmt.Printf("Error enabling TOTP: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot confirm authenticator",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication enabled successfully",
+		"data":    fiber.Map{"recovery_codes": codes},
+	})
+}
+
+// DeleteTOTPHandler turns two-factor authentication off for the caller
+// after checking a current code or recovery code.
+func (s *FiberServer) DeleteTOTPHandler(c *fiber.Ctx) error {
+	type DeleteTOTP struct {
+		Code string `json:"code" xml:"code" form:"code"`
+	}
+
+	body := new(DeleteTOTP)
+
+	if err := c.BodyParser(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userId := callerID(c)
+
+	ok, err := s.checkSecondFactor(userId, body.Code)
+
+	if err != nil {
+		fmt.Printf("Error checking second factor: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot disable two-factor authentication",
+		})
+	}
+
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	}
+
+	if err := s.db.DisableTOTP(userId); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Error disabling TOTP: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot disable two-factor authentication",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled successfully",
+	})
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/totp"
+	"server/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// mfaDB adds authenticators, recovery codes and challenges to sessionDB.
+type mfaDB struct {
+	sessionDB
+	totp          map[int]*models.TOTP
+	recoveryCodes map[string]bool
+	challenges    map[string]*mfaChallenge
+}
+
+type mfaChallenge struct {
+	userId   int
+	attempts int
+}
+
+func (f *mfaDB) GetUser(email string) (models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (f *mfaDB) SaveTOTPSecret(userId int, secret string) error {
+	if credential, ok := f.totp[userId]; ok && credential.Enabled() {
+		return sql.ErrNoRows
+	}
+	f.totp[userId] = &models.TOTP{UserID: userId, Secret: secret}
+	return nil
+}
+
+func (f *mfaDB) GetTOTP(userId int) (models.TOTP, error) {
+	credential, ok := f.totp[userId]
+	if !ok {
+		return models.TOTP{}, sql.ErrNoRows
+	}
+	return *credential, nil
+}
+
+func (f *mfaDB) EnableTOTP(userId int, counter int64, recoveryCodeHashes []string, now time.Time) error {
+	credential, ok := f.totp[userId]
+	if !ok || credential.Enabled() {
+		return sql.ErrNoRows
+	}
+	credential.EnabledAt = &now
+	credential.LastCounter = &counter
+
+	f.recoveryCodes = map[string]bool{}
+	for _, hash := range recoveryCodeHashes {
+		f.recoveryCodes[hash] = true
+	}
+	return nil
+}
+
+func (f *mfaDB) UseTOTPCounter(userId int, counter int64) error {
+	credential := f.totp[userId]
+	if credential.LastCounter != nil && *credential.LastCounter >= counter {
+		return sql.ErrNoRows
+	}
+	credential.LastCounter = &counter
+	return nil
+}
+
+func (f *mfaDB) UseRecoveryCode(userId int, codeHash string, now time.Time) error {
+	if !f.recoveryCodes[codeHash] {
+		return sql.ErrNoRows
+	}
+	f.recoveryCodes[codeHash] = false
+	return nil
+}
+
+func (f *mfaDB) CreateMFAChallenge(userId int, tokenHash string, expiresAt time.Time) error {
+	f.challenges[tokenHash] = &mfaChallenge{userId: userId}
+	return nil
+}
+
+func (f *mfaDB) AttemptMFAChallenge(tokenHash string, now time.Time, maxAttempts int) (int, error) {
+	challenge, ok := f.challenges[tokenHash]
+	if !ok || challenge.attempts >= maxAttempts {
+		return 0, sql.ErrNoRows
+	}
+	challenge.attempts++
+	return challenge.userId, nil
+}
+
+func (f *mfaDB) DeleteMFAChallenge(tokenHash string) error {
+	if _, ok := f.challenges[tokenHash]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.challenges, tokenHash)
+	return nil
+}
+
+func TestTOTPLogin(t *testing.T) {
+	hash, err := utils.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &mfaDB{
+		sessionDB: sessionDB{
+			fakeDB:   fakeDB{users: map[int]models.User{1: {ID: 1, Email: "ada@example.com", Pass: hash}}},
+			sessions: map[int]*models.Session{},
+			tokens:   map[string]*refreshToken{},
+		},
+		totp:       map[int]*models.TOTP{},
+		challenges: map[string]*mfaChallenge{},
+	}
+
+	app := fiber.New()
+	s := &FiberServer{App: app, db: db}
+
+	app.Post("/login", s.LoginHandler)
+	app.Post("/login/mfa", s.LoginMFAHandler)
+
+	me := app.Group("/me/mfa", func(c *fiber.Ctx) error {
+		c.Locals("user_id", 1)
+		return c.Next()
+	})
+	me.Post("/totp", s.CreateTOTPHandler)
+	me.Post("/totp/confirm", s.ConfirmTOTPHandler)
+
+	post := func(path, body string, out any) *http.Response {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		// Checking the password takes longer than the default timeout
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp
+	}
+
+	var enrolment struct {
+		Data struct {
+			Secret string `json:"secret"`
+			URI    string `json:"uri"`
+		} `json:"data"`
+	}
+	post("/me/mfa/totp", "", &enrolment)
+
+	if !strings.HasPrefix(enrolment.Data.URI, "otpauth://totp/") || !strings.Contains(enrolment.Data.URI, enrolment.Data.Secret) {
+		t.Fatalf("expected an otpauth URI with the secret; got %+v", enrolment.Data)
+	}
+
+	// Until it is confirmed, the authenticator is not asked for
+	var login struct {
+		MFARequired bool   `json:"mfa_required"`
+		Challenge   string `json:"challenge"`
+	}
+	resp := post("/login", `{"email":"ada@example.com","pass":"secret"}`, &login)
+	if login.MFARequired || responseCookies(resp)[accessTokenCookie] == "" {
+		t.Fatalf("expected a pending authenticator not to be required")
+	}
+
+	if resp := post("/me/mfa/totp/confirm", `{"code":"000000"}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a wrong code to be rejected; got %d", resp.StatusCode)
+	}
+
+	code, _ := totp.Code(enrolment.Data.Secret, totp.Counter(time.Now()))
+
+	var confirmation struct {
+		Data struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		} `json:"data"`
+	}
+	if resp := post("/me/mfa/totp/confirm", `{"code":"`+code+`"}`, &confirmation); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the authenticator to be confirmed; got %d", resp.StatusCode)
+	}
+
+	if len(confirmation.Data.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes; got %v", recoveryCodeCount, confirmation.Data.RecoveryCodes)
+	}
+
+	resp = post("/login", `{"email":"ada@example.com","pass":"secret"}`, &login)
+	if !login.MFARequired || login.Challenge == "" {
+		t.Fatalf("expected a challenge once the authenticator is confirmed")
+	}
+
+	if len(responseCookies(resp)) != 0 {
+		t.Errorf("expected no session before the second step; got cookies %v", responseCookies(resp))
+	}
+
+	// The code that confirmed the authenticator cannot be replayed
+	if resp := post("/login/mfa", `{"challenge":"`+login.Challenge+`","code":"`+code+`"}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a used code to be rejected; got %d", resp.StatusCode)
+	}
+
+	recoveryCode := strings.ToLower(confirmation.Data.RecoveryCodes[0])
+
+	resp = post("/login/mfa", `{"challenge":"`+login.Challenge+`","code":"`+recoveryCode+`"}`, nil)
+	if resp.StatusCode != http.StatusOK || responseCookies(resp)[accessTokenCookie] == "" {
+		t.Fatalf("expected a recovery code to start a session; got %d", resp.StatusCode)
+	}
+
+	if resp := post("/login/mfa", `{"challenge":"`+login.Challenge+`","code":"`+confirmation.Data.RecoveryCodes[1]+`"}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a passed challenge to be rejected; got %d", resp.StatusCode)
+	}
+
+	post("/login", `{"email":"ada@example.com","pass":"secret"}`, &login)
+
+	for i := 0; i < mfaChallengeAttempts; i++ {
+		post("/login/mfa", `{"challenge":"`+login.Challenge+`","code":"`+recoveryCode+`"}`, nil)
+	}
+
+	if resp := post("/login/mfa", `{"challenge":"`+login.Challenge+`","code":"`+confirmation.Data.RecoveryCodes[1]+`"}`, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a challenge to stop accepting codes after %d attempts; got %d", mfaChallengeAttempts, resp.StatusCode)
+	}
+}
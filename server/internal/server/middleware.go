@@ -2,40 +2,36 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"server/internal/utils"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func (s *FiberServer) AuthMiddleware(c *fiber.Ctx) error {
-	cookie := c.Cookies("token")
-	authHeader := c.Get("Authorization")
-
-	if cookie == "" && authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Unauthorized",
-		})
+// accessToken returns the access token of a request, from the token cookie
+// or else the Authorization header.
+func accessToken(c *fiber.Ctx) string {
+	if cookie := c.Cookies(accessTokenCookie); cookie != "" {
+		return cookie
 	}
 
-	var token string
-	var err error
+	// Extract token from Authorization Bearer header
+	// Assuming the header format is "Bearer <token>"
+	return strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+}
 
-	if cookie != "" {
-		err = utils.VerifyToken(cookie)
-	} else {
-		// Extract token from Authorization Bearer header
-		// Assuming the header format is "Bearer <token>"
-		token = authHeader[len("Bearer "):]
-		err = nil
-	}
+func (s *FiberServer) AuthMiddleware(c *fiber.Ctx) error {
+	token := accessToken(c)
 
-	if err != nil {
+	if token == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"message": "Unauthorized",
 		})
 	}
 
-	err = utils.VerifyToken(token)
+	err := utils.VerifyToken(token)
 
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -68,6 +64,34 @@ func (s *FiberServer) AuthMiddleware(c *fiber.Ctx) error {
 		})
 	}
 
+	// Access tokens outlive a logout or revocation by up to their lifetime
+	// unless their session is checked too
+	sessionId, err := utils.GetSessionID(token)
+
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	session, err := s.db.GetSession(sessionId)
+	now := time.Now()
+
+	if err != nil || session.UserID != user.ID || !session.Active(now) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	// Last seen times only need to be roughly right, which spares a write
+	// on most requests
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		if err := s.db.TouchSession(session.ID, c.IP(), now); err != nil {
+			fmt.Printf("Error touching session %d: %v\n", session.ID, err)
+		}
+	}
+
+	c.Locals("session_id", session.ID)
 	c.Locals("user_id", user.ID)
 	c.Locals("user_email", user.Email)
 	c.Locals("user_fname", user.FName)
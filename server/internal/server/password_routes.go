@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/internal/notify"
+	"server/internal/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// passwordResetTTL is how long a password reset link can be used.
+	passwordResetTTL = time.Hour
+
+	// passwordResetInterval is how often a reset link can be sent to the
+	// same user.
+	passwordResetInterval = 5 * time.Minute
+
+	// accountEmailTimeout bounds sending an account email in the
+	// background.
+	accountEmailTimeout = 30 * time.Second
+
+	// maxAccountEmails is how many account emails are sent in the
+	// background at once.
+	maxAccountEmails = 32
+)
+
+// accountEmails holds a slot for each account email being sent.
+var accountEmails = make(chan struct{}, maxAccountEmails)
+
+// sendAccountEmail runs send in the background, or drops it if
+// maxAccountEmails are being sent already, so requests for account emails
+// cannot pile up goroutines.
+func sendAccountEmail(send func()) {
+	select {
+	case accountEmails <- struct{}{}:
+		go func() {
+			defer func() { <-accountEmails }()
+			send()
+		}()
+	default:
+		fmt.Printf("Dropping account email: %d are being sent already\n", maxAccountEmails)
+	}
+}
+
+// ForgotPasswordHandler emails a password reset link to the address in the
+// request if it belongs to a user. The response is the same either way, and
+// the lookup happens after responding, so it does not reveal whether the
+// address is registered.
+func (s *FiberServer) ForgotPasswordHandler(c *fiber.Ctx) error {
+	type ForgotPassword struct {
+		Email string `json:"email" xml:"email" form:"email"`
+	}
+
+	body := new(ForgotPassword)
+
+	if err := c.BodyParser(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if body.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email is required",
+		})
+	}
+
+	sendAccountEmail(func() { s.sendPasswordReset(body.Email) })
+
+	return c.JSON(fiber.Map{
+		"message": "If the email is registered, a reset link has been sent to it",
+	})
+}
+
+// sendPasswordReset issues a reset token for the user with email, if any,
+// and emails them a link to use it, unless a link was sent within
+// passwordResetInterval.
+func (s *FiberServer) sendPasswordReset(email string) {
+	user, err := s.db.GetUser(email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error getting user for password reset: %v\n", err)
+		return
+	}
+
+	token, err := utils.RandomToken(32)
+
+	if err != nil {
+		fmt.Printf("Error creating password reset token: %v\n", err)
+		return
+	}
+
+	now := time.Now()
+
+	err = s.db.SavePasswordResetToken(user.ID, utils.HashToken(token), now.Add(passwordResetTTL), now, now.Add(-passwordResetInterval))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error saving password reset token: %v\n", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.appURL, token)
+
+	ctx, cancel := context.WithTimeout(context.Background(), accountEmailTimeout)
+	defer cancel()
+
+	err = s.email.SendEmail(ctx, notify.Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Someone asked to reset the password of your account.\n\n"+
+			"Open the link below within %s to choose a new one:\n\n%s\n\n"+
+			"If it was not you, you can ignore this email.\n", passwordResetTTL, link),
+	})
+
+	if err != nil {
+		fmt.Printf("Error sending password reset email: %v\n", err)
+	}
+}
+
+// ResetPasswordHandler sets a new password with a token from a reset link.
+// Every session of the user is signed out, including the caller's.
+func (s *FiberServer) ResetPasswordHandler(c *fiber.Ctx) error {
+	type ResetPassword struct {
+		Token string `json:"token" xml:"token" form:"token"`
+		Pass  string `json:"pass" xml:"pass" form:"pass"`
+	}
+
+	body := new(ResetPassword)
+
+	if err := c.BodyParser(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if body.Pass == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Password is required",
+		})
+	}
+
+	hashedPassword, err := utils.HashPassword(body.Pass)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	_, err = s.db.ResetPassword(utils.HashToken(body.Token), hashedPassword, time.Now())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired reset token",
+		})
+	}
+
+	if err != nil {
+		fmt.Printf("Error resetting password: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot reset password",
+		})
+	}
+
+	clearSessionCookies(c)
+
+	return c.JSON(fiber.Map{
+		"message": "Password reset successfully",
+	})
+}
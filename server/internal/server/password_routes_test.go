@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/notify"
+	"server/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// passwordDB adds reset tokens to fakeDB. Reset links are requested in the
+// background, so it is guarded by a mutex.
+type passwordDB struct {
+	fakeDB
+	mu     sync.Mutex
+	tokens map[string]int
+	// issued is when each user was last issued a token
+	issued map[int]time.Time
+}
+
+func (f *passwordDB) GetUser(email string) (models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (f *passwordDB) SavePasswordResetToken(userId int, tokenHash string, expiresAt, now, since time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if issued, ok := f.issued[userId]; ok && issued.After(since) {
+		return sql.ErrNoRows
+	}
+	f.issued[userId] = now
+
+	for hash, id := range f.tokens {
+		if id == userId {
+			delete(f.tokens, hash)
+		}
+	}
+	f.tokens[tokenHash] = userId
+	return nil
+}
+
+func (f *passwordDB) ResetPassword(tokenHash, passHash string, now time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	userId, ok := f.tokens[tokenHash]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	delete(f.tokens, tokenHash)
+
+	user := f.users[userId]
+	user.Pass = passHash
+	f.users[userId] = user
+	return userId, nil
+}
+
+// fakeMailer hands every email it is asked to send to a channel.
+type fakeMailer struct {
+	notify.Log
+	emails chan notify.Email
+}
+
+func (m fakeMailer) SendEmail(ctx context.Context, email notify.Email) error {
+	m.emails <- email
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	db := &passwordDB{
+		fakeDB: fakeDB{users: map[int]models.User{
+			1: {ID: 1, Email: "ada@example.com", Pass: "old"},
+		}},
+		tokens: map[string]int{},
+		issued: map[int]time.Time{},
+	}
+	mailer := fakeMailer{emails: make(chan notify.Email, 1)}
+
+	app := fiber.New()
+	s := &FiberServer{App: app, db: db, email: mailer, appURL: "https://app.example.com"}
+
+	app.Post("/password/forgot", s.ForgotPasswordHandler)
+	app.Post("/password/reset", s.ResetPasswordHandler)
+
+	post := func(path, body string) (int, string) {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		// Hashing the new password takes longer than the default timeout
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	unknownStatus, unknownBody := post("/password/forgot", `{"email":"nobody@example.com"}`)
+
+	select {
+	case email := <-mailer.emails:
+		t.Fatalf("expected no email for an unknown address; got %+v", email)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	status, body := post("/password/forgot", `{"email":"ada@example.com"}`)
+
+	if status != unknownStatus || body != unknownBody {
+		t.Errorf("expected the same response for known and unknown addresses; got %d %s and %d %s", status, body, unknownStatus, unknownBody)
+	}
+
+	var email notify.Email
+	select {
+	case email = <-mailer.emails:
+	case <-time.After(time.Second):
+		t.Fatal("expected a reset email")
+	}
+
+	prefix := "https://app.example.com/reset-password?token="
+	start := strings.Index(email.Text, prefix)
+	if email.To != "ada@example.com" || start < 0 {
+		t.Fatalf("expected a reset link for ada@example.com; got %+v", email)
+	}
+	token := strings.Fields(email.Text[start+len(prefix):])[0]
+
+	// Asking again right away neither sends another email nor replaces
+	// the link
+	post("/password/forgot", `{"email":"ada@example.com"}`)
+
+	select {
+	case email := <-mailer.emails:
+		t.Fatalf("expected no second email within %s; got %+v", passwordResetInterval, email)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if status, _ := post("/password/reset", `{"token":"wrong","pass":"new password"}`); status != http.StatusBadRequest {
+		t.Errorf("expected an unknown token to be rejected; got %d", status)
+	}
+
+	if status, body := post("/password/reset", `{"token":"`+token+`","pass":"new password"}`); status != http.StatusOK {
+		t.Fatalf("expected the password to be reset; got %d %s", status, body)
+	}
+
+	if !utils.CheckPasswordHash("new password", db.users[1].Pass) {
+		t.Errorf("expected the new password to be stored hashed; got %q", db.users[1].Pass)
+	}
+
+	if status, _ := post("/password/reset", `{"token":"`+token+`","pass":"another password"}`); status != http.StatusBadRequest {
+		t.Errorf("expected a used token to be rejected; got %d", status)
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/ecdh"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"os"
+	"server/internal/database"
+	"server/internal/models"
+	"server/internal/notify"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loadVAPIDKeys returns the key pair from VAPID_PUBLIC_KEY and
+// VAPID_PRIVATE_KEY, or else the one stored in the database, generating
+// and storing one on first use so subscriptions survive restarts.
+func loadVAPIDKeys(db database.Service) (notify.VAPIDKeys, error) {
+	keys := notify.VAPIDKeys{
+		Public:  os.Getenv("VAPID_PUBLIC_KEY"),
+		Private: os.Getenv("VAPID_PRIVATE_KEY"),
+	}
+
+	if keys.Public != "" || keys.Private != "" {
+		return keys, nil
+	}
+
+	public, private, err := db.GetVAPIDKeys()
+
+	if err == nil {
+		return notify.VAPIDKeys{Public: public, Private: private}, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return keys, err
+	}
+
+	keys, err = notify.GenerateVAPIDKeys()
+
+	if err != nil {
+		return keys, err
+	}
+
+	if err := db.SaveVAPIDKeys(keys.Public, keys.Private); err != nil {
+		return keys, err
+	}
+
+	log.Println("Generated a new VAPID key pair")
+
+	// Another instance may have stored its keys first
+	public, private, err = db.GetVAPIDKeys()
+
+	return notify.VAPIDKeys{Public: public, Private: private}, err
+}
+
+// newWebPush sets up Web Push with the VAPID keys of the server.
+func newWebPush(db database.Service, appURL string) *notify.WebPush {
+	keys, err := loadVAPIDKeys(db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	subject := os.Getenv("VAPID_SUBJECT")
+
+	if subject == "" {
+		subject = "mailto:admin@localhost"
+	}
+
+	webPush, err := notify.NewWebPush(keys, subject, appURL, db)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return webPush
+}
+
+// decodeKey decodes a key of a browser subscription, which may or may not
+// be padded.
+func decodeKey(key string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(key, "="))
+}
+
+func (s *FiberServer) GetVAPIDPublicKeyHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"message": "VAPID public key retrieved successfully",
+		"data":    fiber.Map{"public_key": s.webPush.PublicKey()},
+	})
+}
+
+func (s *FiberServer) GetPushSubscriptionsHandler(c *fiber.Ctx) error {
+	subscriptions, err := s.db.GetPushSubscriptionsForUser(callerID(c))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get push subscriptions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Push subscriptions retrieved successfully",
+		"data":    fiber.Map{"subscriptions": subscriptions},
+	})
+}
+
+// CreatePushSubscriptionHandler stores the PushSubscription a browser
+// returned from pushManager.subscribe.
+func (s *FiberServer) CreatePushSubscriptionHandler(c *fiber.Ctx) error {
+	type SubscriptionRequest struct {
+		Endpoint string `json:"endpoint" xml:"endpoint" form:"endpoint"`
+		Keys     struct {
+			P256dh string `json:"p256dh" xml:"p256dh" form:"p256dh"`
+			Auth   string `json:"auth" xml:"auth" form:"auth"`
+		} `json:"keys" xml:"keys" form:"keys"`
+	}
+
+	req := new(SubscriptionRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if err := validateHTTPURL(req.Endpoint); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid endpoint",
+		})
+	}
+
+	p256dh, err := decodeKey(req.Keys.P256dh)
+
+	if err == nil {
+		_, err = ecdh.P256().NewPublicKey(p256dh)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid p256dh key",
+		})
+	}
+
+	if auth, err := decodeKey(req.Keys.Auth); err != nil || len(auth) != 16 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid auth secret",
+		})
+	}
+
+	subscription := models.PushSubscription{
+		UserID:    callerID(c),
+		Endpoint:  req.Endpoint,
+		P256dh:    req.Keys.P256dh,
+		Auth:      req.Keys.Auth,
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	}
+
+	err = s.db.SavePushSubscription(&subscription)
+
+	if errors.Is(err, database.ErrPushSubscriptionTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "This browser is subscribed by another account",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot save push subscription",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Push subscription saved successfully",
+		"data":    fiber.Map{"subscription": subscription},
+	})
+}
+
+func (s *FiberServer) DeletePushSubscriptionHandler(c *fiber.Ctx) error {
+	type UnsubscribeRequest struct {
+		Endpoint string `json:"endpoint" xml:"endpoint" form:"endpoint"`
+	}
+
+	req := new(UnsubscribeRequest)
+
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	err := s.db.DeleteUserPushSubscription(req.Endpoint, callerID(c))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Push subscription not found",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete push subscription",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Push subscription deleted successfully",
+	})
+}
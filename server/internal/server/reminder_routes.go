@@ -1,21 +1,165 @@
 package server
 
 import (
-	"strconv"
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/internal/cron"
+	"server/internal/dispatcher"
+	"server/internal/models"
+	"server/internal/recurrence"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// reminderSchedule holds the ways a client can describe when a reminder
+// fires. At most one of Recurrence, RRule, Cron and ReminderInterval may
+// be set; with none of them the reminder fires once at StartsAt.
+type reminderSchedule struct {
+	ReminderInterval string                 `json:"reminder_interval" xml:"reminder_interval" form:"reminder_interval"`
+	ReminderEnd      string                 `json:"reminder_end" xml:"reminder_end" form:"reminder_end"`
+	StartsAt         *time.Time             `json:"starts_at" xml:"starts_at" form:"starts_at"`
+	Recurrence       *recurrence.Recurrence `json:"recurrence" xml:"recurrence" form:"recurrence"`
+	RRule            string                 `json:"rrule" xml:"rrule" form:"rrule"`
+	ExDates          []time.Time            `json:"exdates" xml:"exdates" form:"exdates"`
+	RDates           []time.Time            `json:"rdates" xml:"rdates" form:"rdates"`
+	Cron             string                 `json:"cron" xml:"cron" form:"cron"`
+	TimeZone         string                 `json:"time_zone" xml:"time_zone" form:"time_zone"`
+}
+
+// scheduleOf returns the schedule a reminder currently has, as a starting
+// point for partial changes.
+func scheduleOf(reminder models.Reminder) reminderSchedule {
+	return reminderSchedule{
+		StartsAt:   &reminder.StartsAt,
+		TimeZone:   reminder.TimeZone,
+		Recurrence: reminder.Recurrence,
+		Cron:       reminder.CronExpression,
+	}
+}
+
+// apply validates the schedule and stores it on reminder, including when
+// the reminder fires next. Wall clock times are interpreted in the
+// schedule's time zone or else in the time zone of user. Occurrences that
+// are already in the past are not fired, and a pending reminder must have
+// at least one occurrence left.
+func (in reminderSchedule) apply(reminder *models.Reminder, user models.User) error {
+	now := time.Now()
+
+	reminder.TimeZone = strings.TrimSpace(in.TimeZone)
+
+	loc, err := dispatcher.LocationFor(user, *reminder)
+	if err != nil {
+		return err
+	}
+
+	set := 0
+	for _, given := range []bool{in.Recurrence != nil, in.RRule != "", in.Cron != "", strings.TrimSpace(in.ReminderInterval) != ""} {
+		if given {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return fmt.Errorf("only one of recurrence, rrule, cron and reminder_interval can be set")
+	}
+
+	rec := in.Recurrence
+	startsAt := in.StartsAt
+
+	switch {
+	case in.RRule != "":
+		parsed, err := recurrence.ParseRRule(in.RRule, loc)
+		if err != nil {
+			return fmt.Errorf("invalid rrule: %v", err)
+		}
+
+		rec = &parsed.Recurrence
+		if startsAt == nil {
+			startsAt = parsed.Start
+		}
+	case strings.TrimSpace(in.ReminderInterval) != "":
+		// Older clients still send the free text interval and end
+		parsed, err := recurrence.ParseLegacy(in.ReminderInterval, in.ReminderEnd)
+		if err != nil {
+			return fmt.Errorf("invalid reminder interval: %v", err)
+		}
+		rec = &parsed
+	}
+
+	if startsAt != nil {
+		reminder.StartsAt = *startsAt
+	} else if reminder.StartsAt.IsZero() {
+		reminder.StartsAt = now
+	}
+
+	reminder.Recurrence = nil
+	reminder.CronExpression = ""
+	reminder.RecurrenceError = ""
+	reminder.ReminderInterval = ""
+	reminder.ReminderEnd = ""
+
+	switch {
+	case rec != nil:
+		rec.ExDates = append(rec.ExDates, in.ExDates...)
+		rec.RDates = append(rec.RDates, in.RDates...)
+
+		if err := rec.Validate(); err != nil {
+			return fmt.Errorf("invalid recurrence: %v", err)
+		}
+
+		reminder.ScheduleKind = models.ScheduleRecurrence
+		reminder.Recurrence = rec
+
+		// Keep the display columns filled in for clients that still read them
+		reminder.ReminderInterval = rec.String()
+		if rec.Until != nil {
+			reminder.ReminderEnd = rec.Until.Format(time.DateOnly)
+		}
+	case in.Cron != "":
+		if _, err := cron.Parse(in.Cron); err != nil {
+			return fmt.Errorf("invalid cron expression: %v", err)
+		}
+
+		reminder.ScheduleKind = models.ScheduleCron
+		reminder.CronExpression = strings.TrimSpace(in.Cron)
+		reminder.ReminderInterval = reminder.CronExpression
+	default:
+		reminder.ScheduleKind = models.ScheduleOnce
+	}
+
+	schedule, err := dispatcher.ScheduleFor(*reminder, loc)
+	if err != nil {
+		return err
+	}
+
+	from := reminder.StartsAt
+	if now.After(from) {
+		from = now
+	}
+
+	reminder.NextFireAt = nil
+
+	first, ok := dispatcher.First(schedule, from)
+	if ok {
+		reminder.NextFireAt = &first
+	} else if reminder.Status == models.StatusPending {
+		return fmt.Errorf("the schedule has no future occurrences")
+	}
+
+	return nil
+}
+
 func (s *FiberServer) CreateReminderHandler(c *fiber.Ctx) error {
 	type ReminderCreate struct {
-		UserID           int    `json:"user_id" xml:"user_id" form:"user_id"`
-		Name             string `json:"name" xml:"name" form:"name"`
-		Status           string `json:"status" xml:"status" form:"status"`
-		Description      string `json:"description" xml:"description" form:"description"`
-		Category         string `json:"category" xml:"category" form:"category"`
-		ReminderInterval string `json:"reminder_interval" xml:"reminder_interval" form:"reminder_interval"`
-		ReminderEnd      string `json:"reminder_end" xml:"reminder_end" form:"reminder_end"`
+		reminderSchedule
+		Name        string `json:"name" xml:"name" form:"name"`
+		Status      string `json:"status" xml:"status" form:"status"`
+		Description string `json:"description" xml:"description" form:"description"`
+		Category    string `json:"category" xml:"category" form:"category"`
+		ChannelID   *int   `json:"channel_id" xml:"channel_id" form:"channel_id"`
 	}
 
 	reminder := new(ReminderCreate)
@@ -26,38 +170,65 @@ func (s *FiberServer) CreateReminderHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	err := s.db.SaveReminder(reminder.UserID, reminder.Name, reminder.Status, reminder.Description, reminder.Category, reminder.ReminderInterval, reminder.ReminderEnd)
+	record := models.Reminder{
+		UserID:      callerID(c),
+		Name:        reminder.Name,
+		Status:      reminder.Status,
+		Description: reminder.Description,
+		Category:    reminder.Category,
+		ChannelID:   reminder.ChannelID,
+	}
 
-	if err != nil {
+	if record.Status == "" {
+		record.Status = models.StatusPending
+	}
+
+	if record.Status != models.StatusPending {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot save reminder",
+			"error": "New reminders must be pending",
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "Reminder created successfully",
-		"data":    fiber.Map{"reminder": reminder},
-	})
-}
+	user, err := s.db.GetUserById(record.UserID)
 
-func (s *FiberServer) GetRemindersHandler(c *fiber.Ctx) error {
-	id := c.Params("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	if err := reminder.apply(&record, user); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid schedule: %v", err),
+		})
+	}
 
-	id = strings.TrimSpace(id)
+	if ferr := s.checkReminderChannel(record); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
 
-	reminderId, err := strconv.Atoi(id)
+	err = s.db.SaveReminder(&record)
 
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid reminder ID",
+			"error": "Cannot save reminder",
 		})
 	}
 
-	reminder, err := s.db.GetReminderById(reminderId)
+	return c.JSON(fiber.Map{
+		"message": "Reminder created successfully",
+		"data":    fiber.Map{"reminder": record},
+	})
+}
+
+func (s *FiberServer) GetRemindersHandler(c *fiber.Ctx) error {
+	reminder, ferr := s.ownedReminder(c)
 
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot get reminder",
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
 		})
 	}
 
@@ -68,7 +239,13 @@ func (s *FiberServer) GetRemindersHandler(c *fiber.Ctx) error {
 }
 
 func (s *FiberServer) GetRemindersForUserHandler(c *fiber.Ctx) error {
-	userId := c.Locals("user_id").(int)
+	userId, ferr := s.authorizedUserParam(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
 
 	reminders, err := s.db.GetAllRemindersForUser(userId)
 
@@ -98,3 +275,228 @@ func (s *FiberServer) GetAllRemindersHandler(c *fiber.Ctx) error {
 		"data":    fiber.Map{"reminders": reminders},
 	})
 }
+
+func (s *FiberServer) UpdateReminderHandler(c *fiber.Ctx) error {
+	type ReminderUpdate struct {
+		reminderSchedule
+		Name        string `json:"name" xml:"name" form:"name"`
+		Status      string `json:"status" xml:"status" form:"status"`
+		Description string `json:"description" xml:"description" form:"description"`
+		Category    string `json:"category" xml:"category" form:"category"`
+		ChannelID   *int   `json:"channel_id" xml:"channel_id" form:"channel_id"`
+	}
+
+	reminder, ferr := s.ownedReminder(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	update := new(ReminderUpdate)
+
+	if err := c.BodyParser(update); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	original := reminder
+
+	reminder.Name = update.Name
+	reminder.Status = update.Status
+	reminder.Description = update.Description
+	reminder.Category = update.Category
+	reminder.ChannelID = update.ChannelID
+
+	if reminder.Status == "" {
+		reminder.Status = original.Status
+	}
+
+	return s.saveReminderUpdate(c, original, reminder, &update.reminderSchedule)
+}
+
+func (s *FiberServer) PatchReminderHandler(c *fiber.Ctx) error {
+	type ReminderPatch struct {
+		Name             *string                `json:"name" xml:"name" form:"name"`
+		Status           *string                `json:"status" xml:"status" form:"status"`
+		Description      *string                `json:"description" xml:"description" form:"description"`
+		Category         *string                `json:"category" xml:"category" form:"category"`
+		ReminderInterval *string                `json:"reminder_interval" xml:"reminder_interval" form:"reminder_interval"`
+		ReminderEnd      *string                `json:"reminder_end" xml:"reminder_end" form:"reminder_end"`
+		StartsAt         *time.Time             `json:"starts_at" xml:"starts_at" form:"starts_at"`
+		Recurrence       *recurrence.Recurrence `json:"recurrence" xml:"recurrence" form:"recurrence"`
+		RRule            *string                `json:"rrule" xml:"rrule" form:"rrule"`
+		ExDates          []time.Time            `json:"exdates" xml:"exdates" form:"exdates"`
+		RDates           []time.Time            `json:"rdates" xml:"rdates" form:"rdates"`
+		Cron             *string                `json:"cron" xml:"cron" form:"cron"`
+		TimeZone         *string                `json:"time_zone" xml:"time_zone" form:"time_zone"`
+		ChannelID        *int                   `json:"channel_id" xml:"channel_id" form:"channel_id"`
+	}
+
+	reminder, ferr := s.ownedReminder(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	patch := new(ReminderPatch)
+
+	if err := c.BodyParser(patch); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	original := reminder
+
+	if patch.Name != nil {
+		reminder.Name = *patch.Name
+	}
+	if patch.Status != nil {
+		reminder.Status = *patch.Status
+	}
+	if patch.Description != nil {
+		reminder.Description = *patch.Description
+	}
+	if patch.Category != nil {
+		reminder.Category = *patch.Category
+	}
+	// A channel_id of 0 removes the channel override
+	if patch.ChannelID != nil {
+		reminder.ChannelID = patch.ChannelID
+		if *patch.ChannelID == 0 {
+			reminder.ChannelID = nil
+		}
+	}
+
+	// Start from the current schedule and replace only what was sent
+	schedule := scheduleOf(reminder)
+	schedule.ExDates = patch.ExDates
+	schedule.RDates = patch.RDates
+	changed := patch.ExDates != nil || patch.RDates != nil
+
+	if patch.StartsAt != nil {
+		schedule.StartsAt = patch.StartsAt
+		changed = true
+	}
+
+	if patch.TimeZone != nil {
+		schedule.TimeZone = *patch.TimeZone
+		changed = true
+	}
+
+	if patch.Recurrence != nil || patch.RRule != nil || patch.Cron != nil || patch.ReminderInterval != nil {
+		schedule.Recurrence = patch.Recurrence
+		schedule.Cron = ""
+
+		if patch.RRule != nil {
+			schedule.RRule = *patch.RRule
+		}
+		if patch.Cron != nil {
+			schedule.Cron = *patch.Cron
+		}
+		if patch.ReminderInterval != nil {
+			schedule.ReminderInterval = *patch.ReminderInterval
+		}
+		if patch.ReminderEnd != nil {
+			schedule.ReminderEnd = *patch.ReminderEnd
+		}
+		changed = true
+	}
+
+	if !changed {
+		return s.saveReminderUpdate(c, original, reminder, nil)
+	}
+
+	return s.saveReminderUpdate(c, original, reminder, &schedule)
+}
+
+// saveReminderUpdate checks that the status change from original to
+// reminder is allowed, applies schedule, if any, and saves reminder.
+func (s *FiberServer) saveReminderUpdate(c *fiber.Ctx, original, reminder models.Reminder, schedule *reminderSchedule) error {
+	if !models.CanTransition(original.Status, reminder.Status) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Cannot change status from %s to %s", original.Status, reminder.Status),
+		})
+	}
+
+	// A reopened reminder resumes from now rather than firing missed
+	// occurrences
+	if schedule == nil && reminder.Status == models.StatusPending && original.Status != models.StatusPending {
+		current := scheduleOf(reminder)
+		schedule = &current
+	}
+
+	if ferr := s.checkReminderChannel(reminder); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	if schedule != nil {
+		user, err := s.db.GetUserById(reminder.UserID)
+
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot get user",
+			})
+		}
+
+		if err := schedule.apply(&reminder, user); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid schedule: %v", err),
+			})
+		}
+	}
+
+	err := s.db.UpdateReminder(&reminder)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Reminder not found",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update reminder",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reminder updated successfully",
+		"data":    fiber.Map{"reminder": reminder},
+	})
+}
+
+func (s *FiberServer) DeleteReminderHandler(c *fiber.Ctx) error {
+	reminder, ferr := s.ownedReminder(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	err := s.db.DeleteReminder(reminder.ID, reminder.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Reminder not found",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete reminder",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reminder deleted successfully",
+	})
+}
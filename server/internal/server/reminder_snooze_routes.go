@@ -0,0 +1,197 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/internal/dispatcher"
+	"server/internal/models"
+	"server/internal/tz"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Snooze presets accepted by SnoozeReminderHandler.
+const (
+	SnoozeTomorrowMorning = "tomorrow_morning"
+)
+
+// snoozeMorningHour is the local hour SnoozeTomorrowMorning snoozes until.
+const snoozeMorningHour = 9
+
+// snoozeUntil resolves a snooze request to the time the reminder should fire
+// again. Exactly one of duration, until or preset must be set.
+func snoozeUntil(duration string, until *time.Time, preset string, now time.Time, loc *time.Location) (time.Time, error) {
+	set := 0
+	for _, ok := range []bool{duration != "", until != nil, preset != ""} {
+		if ok {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return time.Time{}, errors.New("exactly one of duration, until or preset is required")
+	}
+
+	switch {
+	case duration != "":
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid duration %q", duration)
+		}
+		if d <= 0 {
+			return time.Time{}, errors.New("duration must be positive")
+		}
+		return now.Add(d), nil
+	case until != nil:
+		if !until.After(now) {
+			return time.Time{}, errors.New("until must be in the future")
+		}
+		return *until, nil
+	}
+
+	switch preset {
+	case SnoozeTomorrowMorning:
+		local := now.In(loc)
+		return tz.Date(local.Year(), local.Month(), local.Day()+1, snoozeMorningHour, 0, 0, loc), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown preset %q", preset)
+	}
+}
+
+// SnoozeReminderHandler defers the last fired occurrence of a reminder. The
+// schedule is left alone, so the snooze only affects that occurrence. A
+// completed reminder is pending again until the snooze fires, and resumes
+// its schedule from now.
+func (s *FiberServer) SnoozeReminderHandler(c *fiber.Ctx) error {
+	reminder, ferr := s.ownedReminder(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	var body struct {
+		Duration string     `json:"duration" xml:"duration" form:"duration"`
+		Until    *time.Time `json:"until" xml:"until" form:"until"`
+		Preset   string     `json:"preset" xml:"preset" form:"preset"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if reminder.LastFiredAt == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Reminder has not fired yet",
+		})
+	}
+
+	if reminder.Status == models.StatusCancelled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Cannot snooze a cancelled reminder",
+		})
+	}
+
+	user, err := s.db.GetUserById(reminder.UserID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get user",
+		})
+	}
+
+	loc, err := dispatcher.LocationFor(user, reminder)
+
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid time zone: %v", err),
+		})
+	}
+
+	until, err := snoozeUntil(body.Duration, body.Until, body.Preset, time.Now(), loc)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var next *time.Time
+
+	if reminder.Status == models.StatusCompleted {
+		schedule, err := dispatcher.ScheduleFor(reminder, loc)
+
+		if err != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": fmt.Sprintf("Cannot reopen reminder: %v", err),
+			})
+		}
+
+		// Occurrences missed while it was completed are not fired
+		from := reminder.StartsAt
+		if now := time.Now(); now.After(from) {
+			from = now
+		}
+
+		if first, ok := dispatcher.First(schedule, from); ok {
+			next = &first
+		}
+	}
+
+	err = s.db.SnoozeReminder(reminder.ID, reminder.Status, reminder.LastFiredAt, until, next)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Reminder status changed concurrently",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot snooze reminder",
+		})
+	}
+
+	reminder, err = s.db.GetReminderById(reminder.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get reminder",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reminder snoozed successfully",
+		"data":    fiber.Map{"reminder": reminder},
+	})
+}
+
+// GetReminderSnoozesHandler lists how often and until when a reminder was
+// snoozed.
+func (s *FiberServer) GetReminderSnoozesHandler(c *fiber.Ctx) error {
+	reminder, ferr := s.ownedReminder(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	snoozes, err := s.db.GetReminderSnoozes(reminder.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get snoozes",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Snoozes retrieved successfully",
+		"data":    fiber.Map{"snoozes": snoozes, "snooze_count": reminder.SnoozeCount},
+	})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/recurrence"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// snoozeDB adds snoozing to statusDB.
+type snoozeDB struct {
+	statusDB
+}
+
+func (f *snoozeDB) SnoozeReminder(id int, from string, occurrenceAt *time.Time, until time.Time, next *time.Time) error {
+	reminder := f.reminders[id]
+	if f.concurrent != "" {
+		reminder.Status = f.concurrent
+		f.reminders[id] = reminder
+	}
+
+	if reminder.Status != from {
+		return sql.ErrNoRows
+	}
+
+	if reminder.Status == models.StatusCompleted {
+		reminder.NextFireAt = next
+	}
+	reminder.Status = models.StatusPending
+	reminder.SnoozedUntil = &until
+	f.reminders[id] = reminder
+	return nil
+}
+
+func TestSnoozeCompletedReminder(t *testing.T) {
+	startsAt := time.Now().AddDate(0, 0, -7)
+	lastFiredAt := time.Now().AddDate(0, 0, -3)
+	stale := lastFiredAt.AddDate(0, 0, 1)
+
+	for _, tt := range []struct {
+		name       string
+		concurrent string
+		status     int
+	}{
+		{"reopened", "", http.StatusOK},
+		{"changed concurrently", models.StatusCancelled, http.StatusConflict},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &snoozeDB{statusDB{
+				fakeDB: fakeDB{
+					users: map[int]models.User{1: {ID: 1}},
+					reminders: map[int]models.Reminder{
+						10: {ID: 10, UserID: 1, Status: models.StatusCompleted, StartsAt: startsAt, ScheduleKind: models.ScheduleRecurrence,
+							Recurrence: &recurrence.Recurrence{Frequency: recurrence.Daily}, LastFiredAt: &lastFiredAt, NextFireAt: &stale},
+					},
+				},
+				concurrent: tt.concurrent,
+			}}
+
+			app := fiber.New()
+			s := &FiberServer{App: app, db: db}
+
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("user_id", 1)
+				return c.Next()
+			})
+			app.Post("/reminder/:id/snooze", s.SnoozeReminderHandler)
+
+			req := httptest.NewRequest("POST", "/reminder/10/snooze", strings.NewReader(`{"duration":"1h"}`))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected %d; got %d", tt.status, resp.StatusCode)
+			}
+
+			reminder := db.reminders[10]
+
+			if tt.concurrent != "" {
+				if reminder.SnoozedUntil != nil || reminder.NextFireAt != &stale {
+					t.Errorf("expected a conflicting snooze to change nothing; got %+v", reminder)
+				}
+				return
+			}
+
+			if reminder.Status != models.StatusPending || reminder.SnoozedUntil == nil {
+				t.Errorf("expected the reminder to be snoozed and pending; got %+v", reminder)
+			}
+
+			// The schedule resumes from now, not from before it completed
+			if reminder.NextFireAt == nil || !reminder.NextFireAt.After(time.Now()) {
+				t.Errorf("expected the next fire time to be recomputed; got %v", reminder.NextFireAt)
+			}
+		})
+	}
+}
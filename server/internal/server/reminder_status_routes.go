@@ -0,0 +1,93 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func (s *FiberServer) CompleteReminderHandler(c *fiber.Ctx) error {
+	return s.transitionReminder(c, models.StatusCompleted)
+}
+
+func (s *FiberServer) CancelReminderHandler(c *fiber.Ctx) error {
+	return s.transitionReminder(c, models.StatusCancelled)
+}
+
+func (s *FiberServer) ReopenReminderHandler(c *fiber.Ctx) error {
+	return s.transitionReminder(c, models.StatusPending)
+}
+
+// transitionReminder moves the reminder named by the :id route parameter
+// to status to, if its current status allows it.
+func (s *FiberServer) transitionReminder(c *fiber.Ctx, to string) error {
+	reminder, ferr := s.ownedReminder(c)
+
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	from := reminder.Status
+
+	if from == to || !models.CanTransition(from, to) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Cannot change status from %s to %s", from, to),
+		})
+	}
+
+	var err error
+
+	// A reopened reminder resumes from now rather than firing missed
+	// occurrences. Its schedule only changes if the transition applies.
+	if to == models.StatusPending {
+		var user models.User
+		user, err = s.db.GetUserById(reminder.UserID)
+
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Cannot get user",
+			})
+		}
+
+		reminder.Status = to
+		if err := scheduleOf(reminder).apply(&reminder, user); err != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": fmt.Sprintf("Cannot reopen reminder: %v", err),
+			})
+		}
+
+		err = s.db.ReopenReminder(reminder.ID, from, reminder.NextFireAt)
+	} else {
+		err = s.db.TransitionReminderStatus(reminder.ID, from, to)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Reminder status changed concurrently",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot update reminder",
+		})
+	}
+
+	reminder, err = s.db.GetReminderById(reminder.ID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get reminder",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reminder status updated successfully",
+		"data":    fiber.Map{"reminder": reminder},
+	})
+}
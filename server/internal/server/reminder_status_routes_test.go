@@ -0,0 +1,92 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/recurrence"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// statusDB adds conditional status changes to fakeDB. A status in
+// concurrent is what another request changed the reminder to before the
+// transition runs.
+type statusDB struct {
+	fakeDB
+	concurrent string
+}
+
+func (f *statusDB) ReopenReminder(id int, from string, next *time.Time) error {
+	reminder := f.reminders[id]
+	if f.concurrent != "" {
+		reminder.Status = f.concurrent
+	}
+
+	if reminder.Status != from {
+		f.reminders[id] = reminder
+		return sql.ErrNoRows
+	}
+
+	reminder.Status = models.StatusPending
+	reminder.NextFireAt = next
+	f.reminders[id] = reminder
+	return nil
+}
+
+func TestReopenReminder(t *testing.T) {
+	startsAt := time.Now().AddDate(0, 0, -7)
+
+	for _, tt := range []struct {
+		name       string
+		concurrent string
+		status     int
+	}{
+		{"reopened", "", http.StatusOK},
+		{"changed concurrently", models.StatusCancelled, http.StatusConflict},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &statusDB{
+				fakeDB: fakeDB{
+					users: map[int]models.User{1: {ID: 1}},
+					reminders: map[int]models.Reminder{
+						10: {ID: 10, UserID: 1, Status: models.StatusCompleted, StartsAt: startsAt, ScheduleKind: models.ScheduleRecurrence,
+							Recurrence: &recurrence.Recurrence{Frequency: recurrence.Daily}},
+					},
+				},
+				concurrent: tt.concurrent,
+			}
+
+			app := fiber.New()
+			s := &FiberServer{App: app, db: db}
+
+			app.Use(func(c *fiber.Ctx) error {
+				c.Locals("user_id", 1)
+				return c.Next()
+			})
+			app.Post("/reminder/:id/reopen", s.ReopenReminderHandler)
+
+			resp, err := app.Test(httptest.NewRequest("POST", "/reminder/10/reopen", nil))
+			if err != nil {
+				t.Fatalf("error making request to server. Err: %v", err)
+			}
+
+			if resp.StatusCode != tt.status {
+				t.Fatalf("expected %d; got %d", tt.status, resp.StatusCode)
+			}
+
+			// The schedule only moves along with the status
+			next := db.reminders[10].NextFireAt
+			if reopened := tt.concurrent == ""; (next != nil) != reopened {
+				t.Errorf("expected next fire time to be set %t; got %v", reopened, next)
+			}
+			if next != nil && !next.After(time.Now()) {
+				t.Errorf("expected the reminder to resume in the future; got %v", next)
+			}
+		})
+	}
+}
@@ -1,9 +1,13 @@
 package server
 
 import (
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
+	"net/mail"
+	"server/internal/tz"
 	"server/internal/utils"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -27,17 +31,91 @@ func (s *FiberServer) RegisterFiberRoutes() {
 
 	v1.Post("/login", s.LoginHandler)
 
+	v1.Post("/login/mfa", s.LoginMFAHandler)
+
 	v1.Post("/register", s.RegisterUserHandler)
 
+	v1.Post("/refresh", s.RefreshHandler)
+
+	v1.Post("/logout", s.LogoutHandler)
+
+	v1.Post("/password/forgot", s.ForgotPasswordHandler)
+
+	v1.Post("/password/reset", s.ResetPasswordHandler)
+
+	v1.Post("/email/verify", s.VerifyEmailHandler)
+
+	v1.Post("/email/verification", s.ResendEmailVerificationHandler)
+
+	v1.Post("/telegram/updates", s.TelegramUpdatesHandler)
+
+	v1.Get("/push/vapid-public-key", s.GetVAPIDPublicKeyHandler)
+
 	v1.Use(s.AuthMiddleware)
 
 	v1.Post("/reminder", s.CreateReminderHandler)
 
-	v1.Get("/reminder", s.GetRemindersHandler)
+	v1.Get("/reminder/:id", s.GetRemindersHandler)
+
+	v1.Put("/reminder/:id", s.UpdateReminderHandler)
+
+	v1.Patch("/reminder/:id", s.PatchReminderHandler)
+
+	v1.Delete("/reminder/:id", s.DeleteReminderHandler)
+
+	v1.Post("/reminder/:id/complete", s.CompleteReminderHandler)
+
+	v1.Post("/reminder/:id/cancel", s.CancelReminderHandler)
+
+	v1.Post("/reminder/:id/reopen", s.ReopenReminderHandler)
+
+	v1.Post("/reminder/:id/snooze", s.SnoozeReminderHandler)
+
+	v1.Get("/reminder/:id/snoozes", s.GetReminderSnoozesHandler)
 
 	v1.Get("/reminders-user/:user_id", s.GetRemindersForUserHandler)
 
-	v1.Get("/all-reminders", s.GetAllRemindersHandler)
+	v1.Get("/all-reminders", s.AdminMiddleware, s.GetAllRemindersHandler)
+
+	v1.Get("/me", s.GetMeHandler)
+
+	v1.Patch("/me", s.UpdateMeHandler)
+
+	v1.Get("/me/channels", s.GetChannelsHandler)
+
+	v1.Post("/me/channels", s.CreateChannelHandler)
+
+	v1.Get("/me/channels/:id", s.GetChannelHandler)
+
+	v1.Patch("/me/channels/:id", s.PatchChannelHandler)
+
+	v1.Delete("/me/channels/:id", s.DeleteChannelHandler)
+
+	v1.Get("/me/sessions", s.GetSessionsHandler)
+
+	v1.Delete("/me/sessions", s.DeleteOtherSessionsHandler)
+
+	v1.Delete("/me/sessions/:id", s.DeleteSessionHandler)
+
+	v1.Post("/me/mfa/totp", s.CreateTOTPHandler)
+
+	v1.Post("/me/mfa/totp/confirm", s.ConfirmTOTPHandler)
+
+	v1.Delete("/me/mfa/totp", s.DeleteTOTPHandler)
+
+	v1.Post("/me/telegram/link", s.CreateTelegramLinkHandler)
+
+	v1.Get("/push/subscriptions", s.GetPushSubscriptionsHandler)
+
+	v1.Post("/push/subscriptions", s.CreatePushSubscriptionHandler)
+
+	v1.Delete("/push/subscriptions", s.DeletePushSubscriptionHandler)
+
+	v1.Get("/deliveries", s.GetDeliveriesHandler)
+
+	v1.Get("/deliveries/:id", s.GetDeliveryHandler)
+
+	v1.Post("/deliveries/:id/redrive", s.RedriveDeliveryHandler)
 }
 
 func (s *FiberServer) HelloWorldHandler(c *fiber.Ctx) error {
@@ -52,6 +130,11 @@ func (s *FiberServer) healthHandler(c *fiber.Ctx) error {
 	return c.JSON(s.db.Health())
 }
 
+// unknownUserPasswordHash is a bcrypt hash of a random password, at the
+// cost utils.HashPassword uses, that logins for unknown emails are checked
+// against.
+const unknownUserPasswordHash = "$2a$14$BPbf3W/LkvmR/LWKK9vFMOzjuhjQRNP2kZfYhStM8/wC7QY1taz/2"
+
 func (s *FiberServer) LoginHandler(c *fiber.Ctx) error {
 	type UserLogin struct {
 		Email string `json:"email" xml:"email" form:"email"`
@@ -69,53 +152,52 @@ func (s *FiberServer) LoginHandler(c *fiber.Ctx) error {
 	// check if user exists in database
 	userFromDatabase, err := s.db.GetUser(user.Email)
 
-	fmt.Printf("User from database: %v\n", err)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Error getting user: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
 
+	// Unknown emails are checked against a hash too and get the same
+	// response, so logins do not reveal which emails have accounts
+	hash := userFromDatabase.Pass
 	if err != nil {
+		hash = unknownUserPasswordHash
+	}
+
+	if !utils.CheckPasswordHash(user.Pass, hash) || err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not found",
+			"error": "Invalid email or password",
 		})
 	}
 
-	// check if password is correct
-	fmt.Printf("User from database: %v\n", userFromDatabase)
-	fmt.Printf("User from request: %v\n", user)
-
-	if !utils.CheckPasswordHash(user.Pass, userFromDatabase.Pass) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid password",
+	if s.emailVerification == verificationLogin && userFromDatabase.EmailVerifiedAt == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Email address is not verified",
 		})
 	}
 
-	userJson, err := json.Marshal(fiber.Map{
-		"email": user.Email,
-		"fname": userFromDatabase.Fname,
-		"lname": userFromDatabase.Lname,
-		"id":    userFromDatabase.ID,
-	})
+	credential, err := s.db.GetTOTP(userFromDatabase.ID)
 
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Error getting TOTP: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	token, err := utils.CreateToken(string(userJson))
+	if err == nil && credential.Enabled() {
+		return s.startMFAChallenge(c, userFromDatabase)
+	}
 
-	if err != nil {
+	if err := s.startSession(c, userFromDatabase); err != nil {
+		fmt.Printf("Error starting session: %v\n", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "token",
-		Value:    token,
-		Secure:   true,
-		HTTPOnly: true,
-		Expires:  time.Now().Add(time.Hour * 24),
-	})
-
 	c.Status(fiber.StatusOK)
 	return c.JSON(fiber.Map{
 		"email": user.Email,
@@ -124,10 +206,11 @@ func (s *FiberServer) LoginHandler(c *fiber.Ctx) error {
 
 func (s *FiberServer) RegisterUserHandler(c *fiber.Ctx) error {
 	type UserRegister struct {
-		Email string `json:"email" xml:"email" form:"email"`
-		Pass  string `json:"pass" xml:"pass" form:"pass"`
-		Fname string `json:"fname" xml:"fname" form:"fname"`
-		Lname string `json:"lname" xml:"lname" form:"lname"`
+		Email    string `json:"email" xml:"email" form:"email"`
+		Pass     string `json:"pass" xml:"pass" form:"pass"`
+		Fname    string `json:"fname" xml:"fname" form:"fname"`
+		Lname    string `json:"lname" xml:"lname" form:"lname"`
+		TimeZone string `json:"time_zone" xml:"time_zone" form:"time_zone"`
 	}
 
 	user := new(UserRegister)
@@ -138,6 +221,27 @@ func (s *FiberServer) RegisterUserHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	// Verification links are sent to the address, so it must be one
+	address, err := mail.ParseAddress(strings.TrimSpace(user.Email))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid email address",
+		})
+	}
+
+	user.Email = address.Address
+
+	if user.TimeZone == "" {
+		user.TimeZone = "UTC"
+	}
+
+	if _, err := tz.Load(user.TimeZone); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid time zone",
+		})
+	}
+
 	hashedPassword, err := utils.HashPassword(user.Pass)
 
 	if err != nil {
@@ -146,7 +250,7 @@ func (s *FiberServer) RegisterUserHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	err = s.db.SaveUser(user.Email, hashedPassword, user.Fname, user.Lname)
+	err = s.db.SaveUser(user.Email, hashedPassword, user.Fname, user.Lname, user.TimeZone)
 
 	if err != nil {
 		fmt.Printf("Error saving user: %v\n", err)
@@ -155,6 +259,12 @@ func (s *FiberServer) RegisterUserHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	if saved, err := s.db.GetUser(user.Email); err != nil {
+		fmt.Printf("Error getting saved user: %v\n", err)
+	} else {
+		sendAccountEmail(func() { s.sendEmailVerification(saved) })
+	}
+
 	c.Status(fiber.StatusCreated)
 
 	return c.JSON(fiber.Map{
@@ -1,10 +1,18 @@
 package server
 
 import (
-	"github.com/gofiber/fiber/v2"
+	"database/sql"
 	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 func TestHandler(t *testing.T) {
@@ -37,3 +45,103 @@ func TestHandler(t *testing.T) {
 		t.Errorf("expected response body to be %v; got %v", expected, string(body))
 	}
 }
+
+// loginDB looks users up by email in fakeDB and saves new ones.
+type loginDB struct {
+	fakeDB
+}
+
+func (f *loginDB) SaveUser(email, pass, fname, lname, timeZone string) error {
+	id := len(f.users) + 1
+	f.users[id] = models.User{ID: id, Email: email, Pass: pass, Fname: fname, Lname: lname, TimeZone: timeZone}
+	return nil
+}
+
+func (f *loginDB) GetUser(email string) (models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func TestLoginFailures(t *testing.T) {
+	hash, err := utils.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	s := &FiberServer{App: app, db: &loginDB{fakeDB{users: map[int]models.User{1: {ID: 1, Email: "ada@example.com", Pass: hash}}}}}
+	app.Post("/login", s.LoginHandler)
+
+	login := func(body string) (int, string) {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		// Checking the password takes longer than the default timeout
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	wrongStatus, wrongBody := login(`{"email":"ada@example.com","pass":"wrong"}`)
+	unknownStatus, unknownBody := login(`{"email":"bob@example.com","pass":"secret"}`)
+
+	if wrongStatus != http.StatusUnauthorized || unknownStatus != http.StatusUnauthorized {
+		t.Fatalf("expected both logins to be unauthorized; got %d and %d", wrongStatus, unknownStatus)
+	}
+
+	if wrongBody != unknownBody {
+		t.Errorf("expected a wrong password and an unknown email to respond the same; got %s and %s", wrongBody, unknownBody)
+	}
+}
+
+// ClaimEmailVerification reports every address as verified, so registering
+// sends no email.
+func (f *loginDB) ClaimEmailVerification(userId int, now, since time.Time) error {
+	return sql.ErrNoRows
+}
+
+func TestRegisterEmail(t *testing.T) {
+	db := &loginDB{fakeDB{users: map[int]models.User{}}}
+
+	app := fiber.New()
+	s := &FiberServer{App: app, db: db}
+	app.Post("/register", s.RegisterUserHandler)
+
+	register := func(email string) int {
+		req := httptest.NewRequest("POST", "/register", strings.NewReader(`{"email":`+jsonString(email)+`,"pass":"secret"}`))
+		req.Header.Set("Content-Type", "application/json")
+
+		// Hashing the password takes longer than the default timeout
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, email := range []string{"", "ada", "ada@", "@example.com", "ada@example.com, bob@example.com"} {
+		if status := register(email); status != http.StatusBadRequest {
+			t.Errorf("expected %q to be rejected; got %d", email, status)
+		}
+	}
+
+	if len(db.users) != 0 {
+		t.Fatalf("expected no users to be saved; got %v", db.users)
+	}
+
+	if status := register(" Ada <ada@example.com> "); status != http.StatusCreated {
+		t.Fatalf("expected a valid address to register; got %d", status)
+	}
+
+	if email := db.users[1].Email; email != "ada@example.com" {
+		t.Errorf("expected the bare address to be saved; got %q", email)
+	}
+}
@@ -1,11 +1,23 @@
 package server
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+)
 
 func (s *FiberServer) SendNotifications(c *fiber.Ctx) error {
-	resp := fiber.Map{
-		"message": "Hello World",
+	summary, err := s.dispatcher.Dispatch(c.Context())
+
+	if err != nil {
+		fmt.Printf("Error dispatching reminders: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot dispatch reminders",
+		})
 	}
 
-	return c.JSON(resp)
+	return c.JSON(fiber.Map{
+		"message": "Reminders dispatched successfully",
+		"data":    summary,
+	})
 }
@@ -1,9 +1,15 @@
 package server
 
 import (
+	"log"
+
 	"github.com/gofiber/fiber/v2"
 
 	"server/internal/database"
+	"server/internal/dispatcher"
+	"server/internal/models"
+	"server/internal/notify"
+	"server/internal/queue"
 
 	"github.com/gofiber/fiber/v2/middleware/cors"
 )
@@ -12,6 +18,30 @@ type FiberServer struct {
 	*fiber.App
 
 	db database.Service
+
+	dispatcher *dispatcher.Dispatcher
+
+	queue *queue.Pool
+
+	// telegram is nil unless a Telegram bot is configured
+	telegram *notify.Telegram
+
+	webPush *notify.WebPush
+
+	// email sends reminders and account emails; it only logs them unless
+	// SMTP is configured
+	email emailSender
+
+	appURL string
+
+	// emailVerification is what an unverified email address blocks
+	emailVerification string
+}
+
+// emailSender is implemented by both notify.SMTP and notify.Log.
+type emailSender interface {
+	notify.Notifier
+	notify.Mailer
 }
 
 func New() *FiberServer {
@@ -24,6 +54,36 @@ func New() *FiberServer {
 		db: database.New(),
 	}
 
+	if config, ok := notify.TelegramConfigFromEnv(); ok {
+		server.telegram = notify.NewTelegram(config)
+	}
+
+	server.appURL = notify.AppURLFromEnv()
+	server.email = newEmailSender()
+	server.webPush = newWebPush(server.db, server.appURL)
+
+	retry, err := dispatcher.RetryPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.dispatcher = dispatcher.New(server.db, server.newNotifier(), retry)
+
+	server.emailVerification, err = emailVerificationFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.dispatcher.RequireVerifiedEmail(server.emailVerification == verificationDelivery)
+
+	queueConfig, err := queue.ConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.queue = queue.New(server.db, queueConfig)
+	server.queue.Handle(models.JobDelivery, server.dispatcher.HandleDelivery)
+
 	// Initialize default config
 	server.Use(cors.New(cors.Config{
 		AllowCredentials: true,
@@ -32,3 +92,55 @@ func New() *FiberServer {
 
 	return server
 }
+
+// Dispatcher returns the dispatcher used by the webhook handler so that
+// other subsystems can share it.
+func (s *FiberServer) Dispatcher() *dispatcher.Dispatcher {
+	return s.dispatcher
+}
+
+// Queue returns the pool of workers that send queued deliveries.
+func (s *FiberServer) Queue() *queue.Pool {
+	return s.queue
+}
+
+// newNotifier routes fired reminders to every supported channel. Email is
+// only logged unless SMTP is configured.
+func (s *FiberServer) newNotifier() notify.Notifier {
+	appURL := s.appURL
+
+	router := notify.Router{
+		models.ChannelEmail:   s.email,
+		models.ChannelWebhook: notify.NewWebhook(),
+		models.ChannelSlack:   notify.NewSlack(),
+		models.ChannelDiscord: notify.NewDiscord(),
+		models.ChannelNtfy:    notify.NewNtfy(appURL),
+		models.ChannelGotify:  notify.NewGotify(appURL),
+		models.ChannelWebPush: s.webPush,
+	}
+
+	if s.telegram != nil {
+		router[models.ChannelTelegram] = s.telegram
+	}
+
+	return router
+}
+
+func newEmailSender() emailSender {
+	config, ok, err := notify.SMTPConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !ok {
+		log.Println("SMTP_HOST is not set, emails will only be logged")
+		return notify.Log{}
+	}
+
+	notifier, err := notify.NewSMTP(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return notifier
+}
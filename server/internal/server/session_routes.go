@@ -0,0 +1,269 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"server/internal/database"
+	"server/internal/models"
+	"server/internal/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Lifetimes of session tokens. Access tokens are short-lived and checked
+// against their session on every request; refresh tokens are single use,
+// and a session ends when its latest one expires unused.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+const (
+	accessTokenCookie  = "token"
+	refreshTokenCookie = "refresh_token"
+)
+
+// maxUserAgentLength caps the user agent stored with a session.
+const maxUserAgentLength = 512
+
+// sessionTouchInterval is how stale the last seen time of a session may
+// get before a request updates it.
+const sessionTouchInterval = time.Minute
+
+// startSession signs user in on a new session and sets its cookies.
+func (s *FiberServer) startSession(c *fiber.Ctx, user models.User) error {
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	session := models.Session{
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IP:        c.IP(),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	}
+
+	if err := s.db.CreateSession(&session, utils.HashToken(refreshToken)); err != nil {
+		return err
+	}
+
+	return setSessionCookies(c, user, session, refreshToken)
+}
+
+// setSessionCookies issues a new access token for session and sets it and
+// the session's refresh token as cookies.
+func setSessionCookies(c *fiber.Ctx, user models.User, session models.Session, refreshToken string) error {
+	userJson, err := json.Marshal(fiber.Map{
+		"email": user.Email,
+		"fname": user.Fname,
+		"lname": user.Lname,
+		"id":    user.ID,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.CreateToken(string(userJson), session.ID, accessTokenTTL)
+
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     accessTokenCookie,
+		Value:    token,
+		Secure:   true,
+		HTTPOnly: true,
+		Expires:  time.Now().Add(accessTokenTTL),
+	})
+
+	c.Cookie(&fiber.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    refreshToken,
+		Secure:   true,
+		HTTPOnly: true,
+		Expires:  session.ExpiresAt,
+	})
+
+	return nil
+}
+
+func clearSessionCookies(c *fiber.Ctx) {
+	c.ClearCookie(accessTokenCookie, refreshTokenCookie)
+}
+
+// RefreshHandler exchanges the refresh token cookie for a new access token
+// and refresh token. Presenting a refresh token that was already exchanged
+// revokes its session.
+func (s *FiberServer) RefreshHandler(c *fiber.Ctx) error {
+	refreshToken := c.Cookies(refreshTokenCookie)
+
+	if refreshToken == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Missing refresh token",
+		})
+	}
+
+	newRefreshToken, err := utils.RandomToken(32)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	now := time.Now()
+	session, err := s.db.RotateRefreshToken(utils.HashToken(refreshToken), utils.HashToken(newRefreshToken), now, now.Add(refreshTokenTTL))
+
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		fmt.Printf("Refresh token reused, revoked session %d of user %d\n", session.ID, session.UserID)
+		clearSessionCookies(c)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session revoked, please log in again",
+		})
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		clearSessionCookies(c)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid refresh token",
+		})
+	}
+
+	if err != nil {
+		fmt.Printf("Error rotating refresh token: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	user, err := s.db.GetUserById(session.UserID)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get user",
+		})
+	}
+
+	if err := setSessionCookies(c, user, session, newRefreshToken); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Internal server error",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session refreshed successfully",
+	})
+}
+
+// LogoutHandler revokes the caller's session and clears its cookies. It
+// works with an expired access token as long as the refresh token is sent.
+func (s *FiberServer) LogoutHandler(c *fiber.Ctx) error {
+	now := time.Now()
+
+	var err error
+	if refreshToken := c.Cookies(refreshTokenCookie); refreshToken != "" {
+		err = s.db.RevokeRefreshTokenSession(utils.HashToken(refreshToken), now)
+	} else if sessionId, serr := utils.GetSessionID(accessToken(c)); serr == nil {
+		err = s.db.RevokeSession(sessionId, now)
+	}
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		fmt.Printf("Error revoking session: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot log out",
+		})
+	}
+
+	clearSessionCookies(c)
+
+	return c.JSON(fiber.Map{
+		"message": "Logged out successfully",
+	})
+}
+
+// GetSessionsHandler lists the active sessions of the caller, marking the
+// one the request was made with.
+func (s *FiberServer) GetSessionsHandler(c *fiber.Ctx) error {
+	sessions, err := s.db.GetActiveSessionsForUser(callerID(c), time.Now())
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot get sessions",
+		})
+	}
+
+	current, _ := c.Locals("session_id").(int)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Sessions retrieved successfully",
+		"data":    fiber.Map{"sessions": sessions},
+	})
+}
+
+// DeleteSessionHandler signs the caller out of one of their sessions.
+// Deleting the current session works like logging out.
+func (s *FiberServer) DeleteSessionHandler(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid session ID",
+		})
+	}
+
+	err = s.db.RevokeUserSession(id, callerID(c), time.Now())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete session",
+		})
+	}
+
+	if current, _ := c.Locals("session_id").(int); id == current {
+		clearSessionCookies(c)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Session deleted successfully",
+	})
+}
+
+// DeleteOtherSessionsHandler signs the caller out everywhere except the
+// session the request was made with.
+func (s *FiberServer) DeleteOtherSessionsHandler(c *fiber.Ctx) error {
+	sessionId, _ := c.Locals("session_id").(int)
+
+	revoked, err := s.db.RevokeOtherSessions(callerID(c), sessionId, time.Now())
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot delete sessions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Other sessions deleted successfully",
+		"data":    fiber.Map{"revoked": revoked},
+	})
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"server/internal/database"
+	"server/internal/models"
+	"server/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sessionDB adds sessions and refresh tokens to fakeDB.
+type sessionDB struct {
+	fakeDB
+	sessions map[int]*models.Session
+	// tokens maps refresh token hashes to their session and whether they
+	// were exchanged already.
+	tokens map[string]*refreshToken
+}
+
+type refreshToken struct {
+	sessionId int
+	used      bool
+}
+
+func (f *sessionDB) CreateSession(session *models.Session, refreshTokenHash string) error {
+	session.ID = len(f.sessions) + 1
+	f.sessions[session.ID] = session
+	f.tokens[refreshTokenHash] = &refreshToken{sessionId: session.ID}
+	return nil
+}
+
+func (f *sessionDB) GetSession(id int) (models.Session, error) {
+	session, ok := f.sessions[id]
+	if !ok {
+		return models.Session{}, sql.ErrNoRows
+	}
+	return *session, nil
+}
+
+func (f *sessionDB) RotateRefreshToken(tokenHash, newTokenHash string, now, expiresAt time.Time) (models.Session, error) {
+	token, ok := f.tokens[tokenHash]
+	if !ok || !f.sessions[token.sessionId].Active(now) {
+		return models.Session{}, sql.ErrNoRows
+	}
+
+	session := f.sessions[token.sessionId]
+	if token.used {
+		session.RevokedAt = &now
+		return *session, database.ErrRefreshTokenReused
+	}
+
+	token.used = true
+	f.tokens[newTokenHash] = &refreshToken{sessionId: session.ID}
+	session.ExpiresAt = expiresAt
+	return *session, nil
+}
+
+func (f *sessionDB) RevokeSession(id int, now time.Time) error {
+	session, ok := f.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	session.RevokedAt = &now
+	return nil
+}
+
+func (f *sessionDB) RevokeRefreshTokenSession(tokenHash string, now time.Time) error {
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	return f.RevokeSession(token.sessionId, now)
+}
+
+func (f *sessionDB) GetActiveSessionsForUser(userId int, now time.Time) ([]models.Session, error) {
+	var sessions []models.Session
+	for id := 1; id <= len(f.sessions); id++ {
+		if session := f.sessions[id]; session.UserID == userId && session.Active(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *sessionDB) TouchSession(id int, ip string, now time.Time) error {
+	f.sessions[id].LastSeenAt = now
+	f.sessions[id].IP = ip
+	return nil
+}
+
+func (f *sessionDB) RevokeUserSession(id, userId int, now time.Time) error {
+	if session, ok := f.sessions[id]; !ok || session.UserID != userId {
+		return sql.ErrNoRows
+	}
+	return f.RevokeSession(id, now)
+}
+
+func (f *sessionDB) RevokeOtherSessions(userId, keepId int, now time.Time) (int, error) {
+	revoked := 0
+	for id, session := range f.sessions {
+		if session.UserID == userId && id != keepId && f.RevokeSession(id, now) == nil {
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+func newSessionApp(db *sessionDB) *fiber.App {
+	app := fiber.New()
+	s := &FiberServer{App: app, db: db}
+
+	app.Post("/refresh", s.RefreshHandler)
+	app.Post("/logout", s.LogoutHandler)
+	app.Get("/protected", s.AuthMiddleware, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	app.Get("/me/sessions", s.AuthMiddleware, s.GetSessionsHandler)
+	app.Delete("/me/sessions", s.AuthMiddleware, s.DeleteOtherSessionsHandler)
+	app.Delete("/me/sessions/:id", s.AuthMiddleware, s.DeleteSessionHandler)
+
+	return app
+}
+
+// responseCookies returns the cookies a response set, by name.
+func responseCookies(resp *http.Response) map[string]string {
+	values := map[string]string{}
+	for _, cookie := range resp.Cookies() {
+		values[cookie.Name] = cookie.Value
+	}
+	return values
+}
+
+func request(t *testing.T, app *fiber.App, method, path string, cookies map[string]string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		t.Fatalf("error creating request. Err: %v", err)
+	}
+
+	for name, value := range cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+	return resp
+}
+
+func TestSessionRefresh(t *testing.T) {
+	db := &sessionDB{
+		fakeDB:   fakeDB{users: map[int]models.User{1: {ID: 1, Email: "user@example.com"}}},
+		sessions: map[int]*models.Session{},
+		tokens:   map[string]*refreshToken{},
+	}
+	app := newSessionApp(db)
+
+	session := models.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.CreateSession(&session, utils.HashToken("first")); err != nil {
+		t.Fatalf("CreateSession() returned error: %v", err)
+	}
+
+	token, err := utils.CreateToken(`{"id":1}`, session.ID, time.Minute)
+	if err != nil {
+		t.Fatalf("CreateToken() returned error: %v", err)
+	}
+
+	if resp := request(t, app, "GET", "/protected", map[string]string{accessTokenCookie: token}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the access token cookie to be accepted; got %d", resp.StatusCode)
+	}
+
+	resp := request(t, app, "POST", "/refresh", map[string]string{refreshTokenCookie: "first"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected refresh to succeed; got %d", resp.StatusCode)
+	}
+
+	rotated := responseCookies(resp)
+	if rotated[refreshTokenCookie] == "" || rotated[refreshTokenCookie] == "first" || rotated[accessTokenCookie] == "" {
+		t.Fatalf("expected new tokens; got %v", rotated)
+	}
+
+	if resp := request(t, app, "GET", "/protected", map[string]string{accessTokenCookie: rotated[accessTokenCookie]}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the refreshed access token to be accepted; got %d", resp.StatusCode)
+	}
+
+	// Replaying the first refresh token revokes the whole session.
+	if resp := request(t, app, "POST", "/refresh", map[string]string{refreshTokenCookie: "first"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a reused refresh token to be rejected; got %d", resp.StatusCode)
+	}
+
+	if resp := request(t, app, "POST", "/refresh", map[string]string{refreshTokenCookie: rotated[refreshTokenCookie]}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the latest refresh token of a revoked session to be rejected; got %d", resp.StatusCode)
+	}
+
+	if resp := request(t, app, "GET", "/protected", map[string]string{accessTokenCookie: rotated[accessTokenCookie]}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected access tokens of a revoked session to be rejected; got %d", resp.StatusCode)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	db := &sessionDB{
+		fakeDB:   fakeDB{users: map[int]models.User{1: {ID: 1}}},
+		sessions: map[int]*models.Session{},
+		tokens:   map[string]*refreshToken{},
+	}
+	app := newSessionApp(db)
+
+	session := models.Session{UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	db.CreateSession(&session, utils.HashToken("refresh"))
+	token, _ := utils.CreateToken(`{"id":1}`, session.ID, time.Minute)
+
+	resp := request(t, app, "POST", "/logout", map[string]string{accessTokenCookie: token, refreshTokenCookie: "refresh"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected logout to succeed; got %d", resp.StatusCode)
+	}
+
+	if cleared := responseCookies(resp); cleared[accessTokenCookie] != "" || cleared[refreshTokenCookie] != "" {
+		t.Errorf("expected logout to clear the cookies; got %v", cleared)
+	}
+
+	if resp := request(t, app, "GET", "/protected", map[string]string{accessTokenCookie: token}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the access token to stop working after logout; got %d", resp.StatusCode)
+	}
+}
+
+func TestSignOutSessions(t *testing.T) {
+	db := &sessionDB{
+		fakeDB:   fakeDB{users: map[int]models.User{1: {ID: 1}, 2: {ID: 2}}},
+		sessions: map[int]*models.Session{},
+		tokens:   map[string]*refreshToken{},
+	}
+	app := newSessionApp(db)
+
+	// Three sessions of user 1 and one of user 2.
+	tokens := map[int]string{}
+	for i, userId := range []int{1, 1, 1, 2} {
+		session := models.Session{UserID: userId, ExpiresAt: time.Now().Add(time.Hour)}
+		db.CreateSession(&session, utils.HashToken(fmt.Sprint("refresh", i)))
+		tokens[session.ID], _ = utils.CreateToken(fmt.Sprintf(`{"id":%d}`, userId), session.ID, time.Minute)
+	}
+
+	as := func(sessionId int) map[string]string {
+		return map[string]string{accessTokenCookie: tokens[sessionId]}
+	}
+
+	if resp := request(t, app, "DELETE", "/me/sessions/4", as(1)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected other users' sessions to be hidden; got %d", resp.StatusCode)
+	}
+
+	if resp := request(t, app, "DELETE", "/me/sessions/2", as(1)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected to sign out session 2; got %d", resp.StatusCode)
+	}
+
+	if resp := request(t, app, "GET", "/protected", as(2)); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected session 2 to be signed out; got %d", resp.StatusCode)
+	}
+
+	if resp := request(t, app, "DELETE", "/me/sessions", as(1)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected to sign out everywhere else; got %d", resp.StatusCode)
+	}
+
+	for id, expected := range map[int]int{1: http.StatusOK, 3: http.StatusUnauthorized, 4: http.StatusOK} {
+		if resp := request(t, app, "GET", "/protected", as(id)); resp.StatusCode != expected {
+			t.Errorf("expected session %d to get status %d; got %d", id, expected, resp.StatusCode)
+		}
+	}
+
+	resp := request(t, app, "GET", "/me/sessions", as(1))
+
+	var body struct {
+		Data struct {
+			Sessions []models.Session `json:"sessions"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("error decoding response. Err: %v", err)
+	}
+
+	if sessions := body.Data.Sessions; len(sessions) != 1 || sessions[0].ID != 1 || !sessions[0].Current {
+		t.Errorf("expected only the current session to be left; got %+v", sessions)
+	}
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/internal/models"
+	"server/internal/notify"
+	"server/internal/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// telegramLinkTTL is how long a Telegram link code can be used.
+const telegramLinkTTL = 10 * time.Minute
+
+// CreateTelegramLinkHandler issues a one-time code the caller sends to the
+// bot to link their Telegram chat.
+func (s *FiberServer) CreateTelegramLinkHandler(c *fiber.Ctx) error {
+	if s.telegram == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Telegram is not configured",
+		})
+	}
+
+	code, err := utils.RandomCode(8)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot create link code",
+		})
+	}
+
+	expiresAt := time.Now().Add(telegramLinkTTL)
+
+	if err := s.db.SaveTelegramLinkCode(callerID(c), utils.HashToken(code), expiresAt); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot create link code",
+		})
+	}
+
+	data := fiber.Map{"code": code, "expires_at": expiresAt}
+
+	if username := s.telegram.Config().Username; username != "" {
+		data["link"] = fmt.Sprintf("https://t.me/%s?start=%s", username, code)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Send the code to the bot to link your chat",
+		"data":    data,
+	})
+}
+
+// TelegramUpdatesHandler receives updates from the Bot API webhook and links
+// chats that send a valid code, either on its own or through /start.
+func (s *FiberServer) TelegramUpdatesHandler(c *fiber.Ctx) error {
+	if s.telegram == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	secret := s.telegram.Config().WebhookSecret
+	header := c.Get("X-Telegram-Bot-Api-Secret-Token")
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(header), []byte(secret)) != 1 {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	update := new(notify.TelegramUpdate)
+
+	// Telegram retries updates it gets an error for, so anything that is
+	// not a link request is acknowledged and dropped
+	if err := c.BodyParser(update); err != nil || update.Message == nil {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	code := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/start")))
+	if code == "" {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	chatID := strconv.FormatInt(update.Message.Chat.ID, 10)
+
+	reply := "Your chat is linked, reminders will be sent here."
+	if err := s.linkTelegramChat(code, chatID); err != nil {
+		fmt.Printf("Cannot link Telegram chat %s: %v\n", chatID, err)
+		reply = "That code is invalid or has expired. Request a new one in Alertify."
+	}
+
+	if err := s.telegram.SendMessage(context.WithoutCancel(c.Context()), chatID, reply); err != nil {
+		fmt.Printf("Cannot reply to Telegram chat %s: %v\n", chatID, err)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// linkTelegramChat registers chatID as a Telegram channel of the user the
+// code was issued to.
+func (s *FiberServer) linkTelegramChat(code, chatID string) error {
+	userId, err := s.db.ConsumeTelegramLinkCode(utils.HashToken(code), time.Now())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("unknown or expired code")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	channels, err := s.db.GetChannelsForUser(userId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		if channel.Kind == models.ChannelTelegram && channel.Address == chatID {
+			return nil
+		}
+	}
+
+	return s.db.SaveChannel(&models.Channel{
+		UserID:  userId,
+		Kind:    models.ChannelTelegram,
+		Address: chatID,
+		Enabled: true,
+	})
+}
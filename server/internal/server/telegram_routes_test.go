@@ -0,0 +1,129 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/notify"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// telegramDB adds link codes and channels to fakeDB.
+type telegramDB struct {
+	fakeDB
+	codes    map[string]int
+	channels []models.Channel
+}
+
+func (f *telegramDB) SaveTelegramLinkCode(userId int, codeHash string, expiresAt time.Time) error {
+	f.codes[codeHash] = userId
+	return nil
+}
+
+func (f *telegramDB) ConsumeTelegramLinkCode(codeHash string, now time.Time) (int, error) {
+	userId, ok := f.codes[codeHash]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	delete(f.codes, codeHash)
+	return userId, nil
+}
+
+func (f *telegramDB) GetChannelsForUser(userId int) ([]models.Channel, error) {
+	return f.channels, nil
+}
+
+func (f *telegramDB) SaveChannel(channel *models.Channel) error {
+	f.channels = append(f.channels, *channel)
+	return nil
+}
+
+func TestTelegramLink(t *testing.T) {
+	replies := make(chan string, 2)
+
+	botAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		replies <- body["text"].(string)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer botAPI.Close()
+
+	db := &telegramDB{codes: map[string]int{}}
+
+	app := fiber.New()
+	s := &FiberServer{
+		App:      app,
+		db:       db,
+		telegram: notify.NewTelegram(notify.TelegramConfig{Token: "123:abc", BaseURL: botAPI.URL, WebhookSecret: "hook"}),
+	}
+
+	app.Post("/telegram/updates", s.TelegramUpdatesHandler)
+	app.Post("/me/telegram/link", func(c *fiber.Ctx) error {
+		c.Locals("user_id", 1)
+		return c.Next()
+	}, s.CreateTelegramLinkHandler)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/me/telegram/link", nil))
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+
+	var link struct {
+		Data struct {
+			Code string `json:"code"`
+		} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&link)
+
+	if len(link.Data.Code) != 8 {
+		t.Fatalf("expected an 8 character code; got %q", link.Data.Code)
+	}
+
+	sendUpdate := func(secret, text string) int {
+		body := `{"update_id":1,"message":{"chat":{"id":4242},"text":` + jsonString(text) + `}}`
+		req := httptest.NewRequest("POST", "/telegram/updates", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := sendUpdate("wrong", "/start "+link.Data.Code); status != http.StatusUnauthorized {
+		t.Errorf("expected updates with a wrong secret to be rejected; got %d", status)
+	}
+
+	if status := sendUpdate("hook", "/start "+strings.ToLower(link.Data.Code)); status != http.StatusOK {
+		t.Fatalf("expected update to be accepted; got %d", status)
+	}
+
+	if reply := <-replies; !strings.Contains(reply, "linked") {
+		t.Errorf("expected a confirmation; got %q", reply)
+	}
+
+	if len(db.channels) != 1 || db.channels[0].UserID != 1 || db.channels[0].Kind != models.ChannelTelegram || db.channels[0].Address != "4242" {
+		t.Errorf("expected the chat to be linked to user 1; got %+v", db.channels)
+	}
+
+	sendUpdate("hook", link.Data.Code)
+
+	if reply := <-replies; !strings.Contains(reply, "invalid") {
+		t.Errorf("expected a used code to be rejected; got %q", reply)
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
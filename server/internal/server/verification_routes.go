@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"server/internal/models"
+	"server/internal/notify"
+	"server/internal/utils"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// What an unverified email address blocks, set with EMAIL_VERIFICATION.
+const (
+	// verificationOff only asks users to verify their address.
+	verificationOff = "off"
+	// verificationDelivery fails the deliveries of unverified users.
+	verificationDelivery = "delivery"
+	// verificationLogin keeps unverified users from logging in.
+	verificationLogin = "login"
+)
+
+const (
+	// emailVerificationTTL is how long a verification link can be used.
+	emailVerificationTTL = 24 * time.Hour
+
+	// emailVerificationInterval is how often a verification email can be
+	// sent to the same user.
+	emailVerificationInterval = time.Minute
+)
+
+// emailVerificationFromEnv returns what EMAIL_VERIFICATION blocks until an
+// address is verified, verificationOff by default.
+func emailVerificationFromEnv() (string, error) {
+	switch value := os.Getenv("EMAIL_VERIFICATION"); value {
+	case "":
+		return verificationOff, nil
+	case verificationOff, verificationDelivery, verificationLogin:
+		return value, nil
+	default:
+		return "", fmt.Errorf("invalid EMAIL_VERIFICATION %q", value)
+	}
+}
+
+// sendEmailVerification emails a user a signed link that verifies their
+// address, unless it is verified already or a link was sent within
+// emailVerificationInterval.
+func (s *FiberServer) sendEmailVerification(user models.User) {
+	now := time.Now()
+
+	err := s.db.ClaimEmailVerification(user.ID, now, now.Add(-emailVerificationInterval))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	if err != nil {
+		fmt.Printf("Error claiming email verification: %v\n", err)
+		return
+	}
+
+	token, err := utils.CreateEmailVerificationToken(user.ID, user.Email, emailVerificationTTL)
+
+	if err != nil {
+		fmt.Printf("Error creating email verification token: %v\n", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.appURL, token)
+
+	ctx, cancel := context.WithTimeout(context.Background(), accountEmailTimeout)
+	defer cancel()
+
+	err = s.email.SendEmail(ctx, notify.Email{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Open the link below within %s to verify your email address:\n\n%s\n\n"+
+			"If you did not create an account, you can ignore this email.\n", emailVerificationTTL, link),
+	})
+
+	if err != nil {
+		fmt.Printf("Error sending email verification: %v\n", err)
+	}
+}
+
+// ResendEmailVerificationHandler emails a new verification link to the
+// address in the request if it belongs to an unverified user. Like
+// ForgotPasswordHandler, it responds the same either way.
+func (s *FiberServer) ResendEmailVerificationHandler(c *fiber.Ctx) error {
+	type ResendVerification struct {
+		Email string `json:"email" xml:"email" form:"email"`
+	}
+
+	body := new(ResendVerification)
+
+	if err := c.BodyParser(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	if body.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Email is required",
+		})
+	}
+
+	sendAccountEmail(func() {
+		user, err := s.db.GetUser(body.Email)
+
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				fmt.Printf("Error getting user for email verification: %v\n", err)
+			}
+			return
+		}
+
+		s.sendEmailVerification(user)
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "If the email is registered and not yet verified, a verification link has been sent to it",
+	})
+}
+
+// VerifyEmailHandler marks an address as verified with the token from a
+// verification link. Links for an address the user has since changed are
+// rejected.
+func (s *FiberServer) VerifyEmailHandler(c *fiber.Ctx) error {
+	type VerifyEmail struct {
+		Token string `json:"token" xml:"token" form:"token"`
+	}
+
+	body := new(VerifyEmail)
+
+	if err := c.BodyParser(body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Cannot parse JSON",
+		})
+	}
+
+	userId, email, err := utils.ParseEmailVerificationToken(body.Token)
+
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification link",
+		})
+	}
+
+	err = s.db.VerifyEmail(userId, email, time.Now())
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired verification link",
+		})
+	}
+
+	if err != nil {
+		fmt.Printf("Error verifying email: %v\n", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Cannot verify email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified successfully",
+	})
+}
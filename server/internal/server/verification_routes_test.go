@@ -0,0 +1,163 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/models"
+	"server/internal/notify"
+	"server/internal/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// verificationDB adds email verification to fakeDB. Verification emails are
+// sent in the background, so it is guarded by a mutex.
+type verificationDB struct {
+	fakeDB
+	mu     sync.Mutex
+	sentAt map[int]time.Time
+}
+
+func (f *verificationDB) GetUser(email string) (models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, sql.ErrNoRows
+}
+
+func (f *verificationDB) ClaimEmailVerification(userId int, now, since time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sentAt, sent := f.sentAt[userId]
+	if f.users[userId].EmailVerifiedAt != nil || sent && sentAt.After(since) {
+		return sql.ErrNoRows
+	}
+	f.sentAt[userId] = now
+	return nil
+}
+
+func (f *verificationDB) VerifyEmail(userId int, email string, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[userId]
+	if !ok || user.Email != email {
+		return sql.ErrNoRows
+	}
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	f.users[userId] = user
+	return nil
+}
+
+func TestEmailVerification(t *testing.T) {
+	db := &verificationDB{
+		fakeDB: fakeDB{users: map[int]models.User{
+			1: {ID: 1, Email: "ada@example.com"},
+		}},
+		sentAt: map[int]time.Time{},
+	}
+	mailer := fakeMailer{emails: make(chan notify.Email, 2)}
+
+	app := fiber.New()
+	s := &FiberServer{App: app, db: db, email: mailer, appURL: "https://app.example.com"}
+
+	app.Post("/email/verification", s.ResendEmailVerificationHandler)
+	app.Post("/email/verify", s.VerifyEmailHandler)
+
+	post := func(path, body string) int {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("error making request to server. Err: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := post("/email/verification", `{"email":"ada@example.com"}`); status != http.StatusOK {
+		t.Fatalf("expected a verification email to be requested; got %d", status)
+	}
+
+	var email notify.Email
+	select {
+	case email = <-mailer.emails:
+	case <-time.After(time.Second):
+		t.Fatal("expected a verification email")
+	}
+
+	prefix := "https://app.example.com/verify-email?token="
+	start := strings.Index(email.Text, prefix)
+	if email.To != "ada@example.com" || start < 0 {
+		t.Fatalf("expected a verification link for ada@example.com; got %+v", email)
+	}
+	token := strings.Fields(email.Text[start+len(prefix):])[0]
+
+	post("/email/verification", `{"email":"ada@example.com"}`)
+
+	select {
+	case email := <-mailer.emails:
+		t.Errorf("expected a second email right away to be throttled; got %+v", email)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if status := post("/email/verify", `{"token":"wrong"}`); status != http.StatusBadRequest {
+		t.Errorf("expected an invalid token to be rejected; got %d", status)
+	}
+
+	stale, _ := utils.CreateEmailVerificationToken(1, "old@example.com", time.Hour)
+	if status := post("/email/verify", `{"token":"`+stale+`"}`); status != http.StatusBadRequest {
+		t.Errorf("expected a token for a previous address to be rejected; got %d", status)
+	}
+
+	if status := post("/email/verify", `{"token":"`+token+`"}`); status != http.StatusOK {
+		t.Fatalf("expected the address to be verified; got %d", status)
+	}
+
+	if db.users[1].EmailVerifiedAt == nil {
+		t.Errorf("expected the user to be verified")
+	}
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	hash, err := utils.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &verificationDB{fakeDB: fakeDB{users: map[int]models.User{
+		1: {ID: 1, Email: "ada@example.com", Pass: hash},
+	}}}
+
+	app := fiber.New()
+	s := &FiberServer{App: app, db: db, emailVerification: verificationLogin}
+
+	app.Post("/login", s.LoginHandler)
+
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"email":"ada@example.com","pass":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	// Checking the password takes longer than the default timeout
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("error making request to server. Err: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected an unverified user to be refused; got %d", resp.StatusCode)
+	}
+}
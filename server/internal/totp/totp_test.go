@@ -0,0 +1,90 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The last six digits of the eight digit RFC 6238 vectors
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() returned error: %v", err)
+		}
+
+		if code != tt.expected {
+			t.Errorf("expected code %s at %d; got %s", tt.expected, tt.unix, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		code    string
+		valid   bool
+		counter int64
+	}{
+		{"current code", now, "050471", true, Counter(now)},
+		{"with spaces", now, "050 471", true, Counter(now)},
+		{"previous period", now.Add(Period), "050471", true, Counter(now)},
+		{"next period", now.Add(-Period), "050471", true, Counter(now)},
+		{"too old", now.Add(2 * Period), "050471", false, 0},
+		{"wrong code", now, "123456", false, 0},
+		{"wrong length", now, "05047", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(rfcSecret, tt.code, tt.at)
+			if ok != tt.valid || counter != tt.counter {
+				t.Errorf("expected (%d, %v); got (%d, %v)", tt.counter, tt.valid, counter, ok)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret() returned error: %v", err)
+	}
+
+	u, err := url.Parse(URI("Alertify", "ada@example.com", secret))
+	if err != nil {
+		t.Fatalf("URI() is not a valid URL: %v", err)
+	}
+
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Alertify:ada@example.com" {
+		t.Errorf("unexpected URI %s", u)
+	}
+
+	if u.Query().Get("secret") != secret || u.Query().Get("issuer") != "Alertify" {
+		t.Errorf("expected secret and issuer in the query; got %s", u.RawQuery)
+	}
+
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("expected a generated secret to be usable; got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package tz
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Load loads an IANA time zone such as "Europe/Berlin". The empty name
+// means UTC. "Local" is rejected because it depends on the server.
+func Load(name string) (*time.Location, error) {
+	switch name {
+	case "", "UTC":
+		return time.UTC, nil
+	case "Local":
+		return nil, errors.New(`time zone "Local" is not allowed`)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// Date is like time.Date, but resolves wall clock times around daylight
+// saving changes the same way in every zone: a time skipped when clocks
+// go forward is moved forward by the length of the gap, so 02:30 becomes
+// 03:30, and a time repeated when clocks go back resolves to its first
+// occurrence.
+func Date(year int, month time.Month, day, hour, minute, sec int, loc *time.Location) time.Time {
+	wall := time.Date(year, month, day, hour, minute, sec, 0, time.UTC)
+
+	// Offsets in effect shortly before and after the wall time. Zones do
+	// not change offset twice within a day, so these cover any transition.
+	_, before := wall.Add(-12 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(12 * time.Hour).In(loc).Zone()
+
+	early := wall.Add(-time.Duration(max(before, after)) * time.Second)
+	late := wall.Add(-time.Duration(min(before, after)) * time.Second)
+
+	for _, t := range []time.Time{early, late} {
+		if sameWall(t.In(loc), wall) {
+			return t.In(loc)
+		}
+	}
+
+	// The wall time falls into a gap; shift it by the offset in effect
+	// before the gap, which lands the same distance past its end.
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+func sameWall(t, wall time.Time) bool {
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := wall.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2 && t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Second() == wall.Second()
+}
@@ -0,0 +1,48 @@
+package tz
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDate(t *testing.T) {
+	tests := []struct {
+		zone     string
+		wall     time.Time
+		expected string
+	}{
+		// Skipped hours move forward by the gap
+		{"America/New_York", time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC), "2024-03-10T03:30:00-04:00"},
+		{"Australia/Sydney", time.Date(2024, 10, 6, 2, 30, 0, 0, time.UTC), "2024-10-06T03:30:00+11:00"},
+		// Repeated hours resolve to their first occurrence
+		{"America/New_York", time.Date(2024, 11, 3, 1, 30, 0, 0, time.UTC), "2024-11-03T01:30:00-04:00"},
+		{"Australia/Sydney", time.Date(2024, 4, 7, 2, 30, 0, 0, time.UTC), "2024-04-07T02:30:00+11:00"},
+		// Ordinary times are unaffected
+		{"Europe/Berlin", time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC), "2024-07-01T09:00:00+02:00"},
+		{"Asia/Kolkata", time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC), "2024-01-01T09:00:00+05:30"},
+	}
+
+	for _, tt := range tests {
+		loc, err := Load(tt.zone)
+		if err != nil {
+			t.Fatalf("Load(%q) returned error: %v", tt.zone, err)
+		}
+
+		got := Date(tt.wall.Year(), tt.wall.Month(), tt.wall.Day(), tt.wall.Hour(), tt.wall.Minute(), 0, loc)
+		if got.Format(time.RFC3339) != tt.expected {
+			t.Errorf("%s %s: expected %s; got %s", tt.zone, tt.wall.Format("2006-01-02 15:04"), tt.expected, got.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	for _, name := range []string{"Local", "Mars/Olympus_Mons"} {
+		if _, err := Load(name); err == nil {
+			t.Errorf("expected Load(%q) to fail", name)
+		}
+	}
+
+	if loc, err := Load(""); err != nil || loc != time.UTC {
+		t.Errorf("expected Load(\"\") to return UTC; got %v, %v", loc, err)
+	}
+}
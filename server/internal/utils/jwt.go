@@ -3,6 +3,7 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,11 +11,14 @@ import (
 
 var secretKey = []byte(os.Getenv("JWT_SECRET"))
 
-func CreateToken(data string) (string, error) {
+// CreateToken signs an access token carrying data for the session with ID
+// sessionId. It expires after ttl.
+func CreateToken(data string, sessionId int, ttl time.Duration) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
 		jwt.MapClaims{
 			"data": data,
-			"exp":  time.Now().Add(time.Hour * 24).Unix(),
+			"sid":  sessionId,
+			"exp":  time.Now().Add(ttl).Unix(),
 		})
 
 	tokenString, err := token.SignedString(secretKey)
@@ -62,3 +66,73 @@ func GetPayload(tokenString string) (string, error) {
 
 	return data, nil
 }
+
+// GetSessionID returns the ID of the session an access token belongs to.
+func GetSessionID(tokenString string) (int, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return secretKey, nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, fmt.Errorf("invalid token")
+	}
+
+	// JSON numbers decode as float64
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid token")
+	}
+
+	return int(sid), nil
+}
+
+// verifyEmailPurpose marks tokens that verify an email address, so access
+// tokens cannot be used as such.
+const verifyEmailPurpose = "verify_email"
+
+// CreateEmailVerificationToken signs a token proving that whoever holds it
+// received mail at email, the address of the user with ID userId. It
+// expires after ttl.
+func CreateEmailVerificationToken(userId int, email string, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
+		jwt.MapClaims{
+			"sub":     strconv.Itoa(userId),
+			"email":   email,
+			"purpose": verifyEmailPurpose,
+			"exp":     time.Now().Add(ttl).Unix(),
+		})
+
+	return token.SignedString(secretKey)
+}
+
+// ParseEmailVerificationToken returns the user ID and email address a
+// token from CreateEmailVerificationToken was issued for.
+func ParseEmailVerificationToken(tokenString string) (int, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return secretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != verifyEmailPurpose {
+		return 0, "", fmt.Errorf("invalid token")
+	}
+
+	sub, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+
+	userId, err := strconv.Atoi(sub)
+	if err != nil || email == "" {
+		return 0, "", fmt.Errorf("invalid token")
+	}
+
+	return userId, email, nil
+}